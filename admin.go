@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	"github.com/tendermint/tendermint/privval"
+	"zkvoting/verifier"
+)
+
+// adminSignDoc is what an admin signs, the chain id keeps a signature from
+// being replayed on another chain and the nonce inside AData on this one
+type adminSignDoc struct {
+	ChainID  string `json:"chain_id"`
+	Election string `json:"election"`
+	Adata    AData  `json:"adata"`
+}
+
+func adminSignBytes(chainID, election string, data AData) ([]byte, error) {
+	return json.Marshal(adminSignDoc{ChainID: chainID, Election: election, Adata: data})
+}
+
+// verifyAdmin checks that trans is signed by a genesis admin with the next nonce
+func (app *DApplication) verifyAdmin(trans Trans) error {
+	if len(trans.PubKey) != ed25519.PubKeySize {
+		return ErrAdminFailed.Wrap(fmt.Errorf("invalid public key"))
+	}
+	known := false
+	for _, admin := range app.admins {
+		if bytes.Equal(admin, trans.PubKey) {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return ErrAdminFailed.Wrap(fmt.Errorf("unknown admin key"))
+	}
+	if trans.Adata.Nonce != app.adminNonce+1 {
+		return ErrAdminFailed.Wrap(fmt.Errorf("expected nonce %d, got %d", app.adminNonce+1, trans.Adata.Nonce))
+	}
+	msg, err := adminSignBytes(app.chainID, trans.Election, trans.Adata)
+	if err != nil {
+		return ErrEncoding.Wrap(err)
+	}
+	if !ed25519.PubKey(trans.PubKey).VerifySignature(msg, trans.Sig) {
+		return ErrAdminFailed.Wrap(fmt.Errorf("invalid signature"))
+	}
+	return nil
+}
+
+// revokeVoter replaces the leaf of a voter with a tombstone, later proofs of
+// membership for it fail while every other voter keeps its index. Every
+// older root still holds the leaf, so the root history is reset and proofs
+// of every voter made before the revoke are refused with ErrUnknownRoot
+func (app *DApplication) revokeVoter(trans Trans) ([]abcitypes.Event, error) {
+	e, err := app.election(trans.Election)
+	if err != nil {
+		return nil, err
+	}
+	if e.phase == PhaseFinalized {
+		return nil, ErrWrongPhase.Wrap(fmt.Errorf("election is %s", e.phase))
+	}
+	index := trans.Adata.Voter
+	leaf, err := e.zktree.Leaf(index)
+	if err != nil {
+		return nil, treeError(err)
+	}
+	if leaf.Cmp(verifier.Tombstone) == 0 || e.revoked[index] {
+		return nil, ErrInvalidLeaf.Wrap(fmt.Errorf("voter %d is already revoked", index))
+	}
+	// the check state shares the tree with the deliver state, it only marks
+	// the voter so a second revoke in the mempool fails before its nonce is used
+	if app.check {
+		e.revoked[index] = true
+	} else {
+		err = e.zktree.Revoke(index)
+		if err != nil {
+			return nil, treeError(err)
+		}
+	}
+	app.adminNonce = trans.Adata.Nonce
+
+	events := []abcitypes.Event{
+		{
+			Type: "revoke",
+			Attributes: []abcitypes.EventAttribute{
+				{Key: []byte("election"), Value: []byte(e.id), Index: true},
+				{Key: []byte("voter id"), Value: []byte(strconv.Itoa(index)), Index: true},
+				{Key: []byte("hash"), Value: []byte(leaf.Text(16)), Index: false},
+				{Key: []byte("root"), Value: []byte(e.zktree.GetRoot().String()), Index: false},
+				// every older root still holds the revoked leaf, so the history
+				// is reset and the proofs of all voters must be made again
+				{Key: []byte("root history"), Value: []byte("reset"), Index: false},
+			},
+		},
+	}
+	return events, nil
+}
+
+// runAdminSign implements `zkvoting admin`, it signs the AData in a json file
+// with an ed25519 key in tendermint's priv_validator_key.json format and
+// prints the admin transaction
+func runAdminSign(args []string) error {
+	fs := flag.NewFlagSet("admin", flag.ExitOnError)
+	keyFile := fs.String("key", "priv_validator_key.json", "Admin key file")
+	chainID := fs.String("chain-id", "", "Chain id from genesis.json")
+	election := fs.String("election", "", "Election id to set up")
+	nonce := fs.Uint64("nonce", 0, "Admin nonce, one more than the last admin transaction")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: zkvoting admin -key <key file> -chain-id <id> -election <id> -nonce <n> <adata.json>")
+	}
+
+	bz, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var data AData
+	err = json.Unmarshal(bz, &data)
+	if err != nil {
+		return err
+	}
+	data.Nonce = *nonce
+
+	pv := privval.LoadFilePVEmptyState(*keyFile, "")
+	msg, err := adminSignBytes(*chainID, *election, data)
+	if err != nil {
+		return err
+	}
+	sig, err := pv.Key.PrivKey.Sign(msg)
+	if err != nil {
+		return err
+	}
+	tx, err := json.Marshal(Trans{
+		Type:     "admin",
+		Election: *election,
+		Adata:    data,
+		PubKey:   pv.Key.PubKey.Bytes(),
+		Sig:      sig,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, string(tx))
+	return nil
+}
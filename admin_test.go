@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	dbm "github.com/tendermint/tm-db"
+	"zkvoting/verifier"
+)
+
+// TestRevokeVoter revokes the sample voter of an election with a second
+// voter. Proofs against any root from before the revoke are refused, the
+// other voter keeps its index and votes against the new root
+func TestRevokeVoter(t *testing.T) {
+	key := newTrapdoorKey(t)
+	chain := newTestChain(t, dbm.NewMemDB(), ed25519.GenPrivKey())
+	data := testElection(t)
+	data.Vkey = key.vkey()
+	chain.block(testBlock{t0, [][]byte{chain.adminTx("e", data)}})
+	chain.block(testBlock{t0 + 20, [][]byte{registerTx(t, "e")}})
+	e := chain.app.elections["e"]
+	other := big.NewInt(42)
+	_, err := e.zktree.QuickInsert(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.block(testBlock{t0 + 21, nil})
+	before := e.zktree.GetRoot()
+
+	res := chain.block(testBlock{t0 + 30, [][]byte{chain.adminTx("e", AData{Action: "revoke", Voter: 0})}})
+	if res[0].Code != CodeTypeOK {
+		t.Fatalf("revoke: code %d (%s)", res[0].Code, res[0].Log)
+	}
+	if leaf, err := e.zktree.Leaf(0); err != nil || leaf.Cmp(verifier.Tombstone) != 0 {
+		t.Fatalf("revoked leaf is %v, %v", leaf, err)
+	}
+	if index, err := e.zktree.IndexOf(other); err != nil || index != 1 {
+		t.Fatalf("other voter moved to %d, %v", index, err)
+	}
+
+	public := func(root *big.Int, nullifier int64) []*big.Int {
+		return []*big.Int{big.NewInt('A'), big.NewInt(nullifier), root, e.signal()}
+	}
+	stale := key.vote("e", key.prove(public(before, 1)), public(before, 1))
+	fresh := key.vote("e", key.prove(public(e.zktree.GetRoot(), 2)), public(e.zktree.GetRoot(), 2))
+	res = chain.block(testBlock{t0 + 60, [][]byte{stale, fresh}})
+	if res[0].Code != CodeTypeUnknownRoot {
+		t.Errorf("proof against the root before the revoke: got code %d (%s), want %d", res[0].Code, res[0].Log, CodeTypeUnknownRoot)
+	}
+	if res[1].Code != CodeTypeOK {
+		t.Errorf("proof against the new root: code %d (%s)", res[1].Code, res[1].Log)
+	}
+
+	res = chain.block(testBlock{t0 + 61, [][]byte{chain.adminTx("e", AData{Action: "revoke", Voter: 0})}})
+	if res[0].Code != CodeTypeInvalidLeaf {
+		t.Errorf("second revoke: got code %d (%s), want %d", res[0].Code, res[0].Log, CodeTypeInvalidLeaf)
+	}
+}
+
+// TestRevokeCheckTx sends the same revoke twice to the mempool. The second
+// one must fail CheckTx so it does not hold the nonce of the next admin tx
+func TestRevokeCheckTx(t *testing.T) {
+	chain := newTestChain(t, dbm.NewMemDB(), ed25519.GenPrivKey())
+	chain.block(testBlock{t0, [][]byte{chain.adminTx("e", testElection(t))}})
+	chain.block(testBlock{t0 + 20, [][]byte{registerTx(t, "e")}})
+
+	first := chain.adminTx("e", AData{Action: "revoke", Voter: 0})
+	again := chain.adminTx("e", AData{Action: "revoke", Voter: 0})
+	chain.nonce--
+	next := chain.adminTx("f", testElection(t))
+	want := []uint32{CodeTypeOK, CodeTypeInvalidLeaf, CodeTypeOK}
+	for i, tx := range [][]byte{first, again, next} {
+		res := chain.app.CheckTx(abcitypes.RequestCheckTx{Tx: tx})
+		if res.Code != want[i] {
+			t.Errorf("tx %d: got code %d (%s), want %d", i, res.Code, res.Log, want[i])
+		}
+	}
+	if chain.app.elections["e"].zktree.GetRoot().Cmp(chain.app.checkState.elections["e"].zktree.GetRoot()) != 0 {
+		t.Fatal("CheckTx changed the tree")
+	}
+	if leaf, _ := chain.app.elections["e"].zktree.Leaf(0); leaf.Cmp(verifier.Tombstone) == 0 {
+		t.Fatal("CheckTx revoked the voter")
+	}
+}
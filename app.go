@@ -1,22 +1,16 @@
 package main
 
 import (
+	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
 	"math/big"
 	"strconv"
-	"github.com/tendermint/tendermint/abci/example/code"
+	"strings"
 	abcitypes "github.com/tendermint/tendermint/abci/types"
 	"github.com/tendermint/tendermint/version"
-	"time"
-	"crypto/sha256"
-	"bytes"
 	"zkvoting/verifier"
-)
-
-const (
-	CodeTypeOK            			uint32 = 0
-	CodeTypeError 				uint32 = 1
+	dbm "github.com/tendermint/tm-db"
 )
 
 var (
@@ -24,24 +18,32 @@ var (
 )
 
 type PData struct{
-	Proof 	verifier.ProofString		`json:"proof"`
+	Proof 	json.RawMessage			`json:"proof"` 	// snarkjs proof.json of the election's protocol
 	Public 	[]string 			`json:"public"`
 }
 
 type AData struct{
-	Vkey	  verifier.VkString		`json:"vkey"`
+	Vkey	  json.RawMessage		`json:"vkey"` 	// snarkjs verification_key.json, plonk or groth16
 	Cand 	  Candidate 			`json:"cand"`
 	RegStart  int64				`json:"regstart"`
 	RegEnd	  int64				`json:"regend"`
 	VoteStart int64				`json:"votestart"`
 	VoteEnd	  int64				`json:"voteend"`
+	Nonce 	  uint64 			`json:"nonce"`
+	Action 	  string 			`json:"action,omitempty"`
+	Hasher 	  string 			`json:"hasher,omitempty"` 	// hash of the voter tree, mimcsponge if empty
+	Voter 	  int 				`json:"voter,omitempty"` 	// voter id to revoke
+	Depth 	  int 				`json:"depth,omitempty"` 	// depth of the voter tree, the genesis depth if empty
 }
 
 type Trans struct{
 	Type	string 				`json:"type"`
+	Election string 			`json:"election"`
 	Vdata	Verify				`json:"vdata"`
 	Pdata	PData				`json:"pdata"`
 	Adata   AData 				`json:"adata"`
+	PubKey 	[]byte 				`json:"pubkey,omitempty"`
+	Sig 	[]byte 				`json:"sig,omitempty"`
 }
 
 type Candidate struct{
@@ -55,32 +57,45 @@ var _ abcitypes.Application = (*DApplication)(nil)
 
 type DApplication struct {
 	abcitypes.BaseApplication
-	zktree 			*verifier.ZkTree 	// voter merkle tree
-	candidate 		map[string]int64 	// candidate list
-	isVoted 		map[string]int 		// check voter
-	isUsed 			map[string]int 		// check Dg15.pubkey
-	leafNode 		[]string 		// zktree leaves
-	voterid 		int 			// number of voter
+	db 			dbm.DB 			// persistent state
+	elections 		map[string]*Election 	// elections by id
+	archive 		[]ElectionRecord 	// results of finalized elections
+	dropped 		[]int 			// voter trees to delete at Commit
 	voteid			int			// vote index
-	verifyKey 		*verifier.Vk 		// verification key
-	vkeyHash 		[32]byte 		// hash of verification key
+	admins 			[][]byte 		// ed25519 keys allowed to sign admin txs
+	adminNonce 		uint64 			// nonce of the last admin tx
+	chainID 		string 			// chain id admin txs are signed for
+	depth 			int 			// depth of the voter tree
+	cscaKeys 		[]CSCAKey 		// trusted passport CSCA keys from genesis
+	csca 			[]*ecdsa.PublicKey 	// parsed cscaKeys
 	height 			int64			// current height of chain
-	zkroot		 	[]byte			// current root of zktree
-	regStart 		int64 			// register start
-	regEnd 			int64			// register end
-	voteStart 		int64 			// vote start
-	voteEnd			int64 			// vote end
+	blockTime 		int64			// header time of the current block
+	appHash 		[]byte			// hash returned by last Commit
+	checkState 		*DApplication 		// state CheckTx runs against, reset at Commit
+	check 			bool 			// true for the check state
+	recheck 		bool 			// current CheckTx is a recheck after Commit
+	restoring 		*snapshotRestore 	// snapshot being applied by state sync
+	blockTxs 		func(int64) [][]byte 	// txs of the block at a height, nil if unknown
+	verdicts 		map[[32]byte]proofVerdict // proofs of the current block verified in BeginBlock
 }
 
-func NewDApplication(vKey []byte) *DApplication {
-	vkey1 := bytes.ReplaceAll(vKey, []byte{32}, []byte(""))
-	vkey2 := bytes.ReplaceAll(vkey1, []byte{10}, []byte(""))
-	hash := sha256.Sum256(vkey2)
-	zktree, err := verifier.NewZkTree(20, []*big.Int{})
+func NewDApplication(db dbm.DB) *DApplication {
+	app := &DApplication{db: db}
+
+	// restore the last committed state if the node was restarted
+	state, err := loadState(db)
 	if err != nil {
 		panic(err)
 	}
-	return &DApplication{zktree: zktree, vkeyHash: hash, regStart: 9999999999999, voteStart: 9999999999999, height:0}
+	if state == nil {
+		state = &State{Depth: defaultDepth}
+	}
+	err = app.restore(state, false)
+	if err != nil {
+		panic(err)
+	}
+	app.checkState = app.copyState()
+	return app
 }
 
 func (app *DApplication) Info(req abcitypes.RequestInfo) abcitypes.ResponseInfo {
@@ -89,7 +104,7 @@ func (app *DApplication) Info(req abcitypes.RequestInfo) abcitypes.ResponseInfo
 		Version:          version.ABCIVersion,
 		AppVersion:       AppVersion,
 		LastBlockHeight:  app.height,
-		LastBlockAppHash: app.zkroot,	
+		LastBlockAppHash: app.appHash,
 	}
 }
 
@@ -97,260 +112,332 @@ func (DApplication) SetOption(req abcitypes.RequestSetOption) abcitypes.Response
 	return abcitypes.ResponseSetOption{}
 }
 
-func (app *DApplication) isValid(tx []byte) (code uint32) {
+func (app *DApplication) CheckTx(req abcitypes.RequestCheckTx) abcitypes.ResponseCheckTx {
+	// run the DeliverTx checks against the check state, it also remembers the
+	// nullifiers and keys of txs already in the mempool so duplicates are refused.
+	// proofs and chip signatures do not depend on state so a recheck skips them
+	app.checkState.recheck = req.Type == abcitypes.CheckTxType_Recheck
+	_, err := app.checkState.runTx(req.Tx)
+	if err != nil {
+		code, log := errorCode(err)
+		return abcitypes.ResponseCheckTx{Code: code, Codespace: Codespace, Log: log, GasWanted: 1}
+	}
+	return abcitypes.ResponseCheckTx{Code: CodeTypeOK, GasWanted: 1}
+}
+
+func (app *DApplication) DeliverTx(req abcitypes.RequestDeliverTx) abcitypes.ResponseDeliverTx {
+	events, err := app.runTx(req.Tx)
+	if err != nil {
+		code, log := errorCode(err)
+		return abcitypes.ResponseDeliverTx{Code: code, Codespace: Codespace, Log: log}
+	}
+	return abcitypes.ResponseDeliverTx{Code: CodeTypeOK, Events: events}
+}
+
+// runTx decodes a transaction and applies it to app
+func (app *DApplication) runTx(tx []byte) ([]abcitypes.Event, error) {
 	var trans Trans
 	err := json.Unmarshal(tx,&trans)
 	if err != nil {
-		return 1
+		return nil, ErrEncoding.Wrap(err)
 	}
-	if trans.Type == "vote" {
-		// check trans.Pdata
-		data := trans.Pdata
-		proof,public := data.Proof,data.Public
 
-		proof1, err := json.Marshal(proof)
-		if err != nil {
-			return 1
-		}
+	switch trans.Type {
+		case "vote":
+			return app.deliverVote(trans, tx)
+		case "register":
+			return app.deliverRegister(trans)
+		case "admin":
+			return app.deliverAdmin(trans)
+		default:
+			return nil, ErrUnknownType
+	}
+}
 
-		public1, err := json.Marshal(public)
-		if err != nil {
-			return 1
-		}
+// copyState returns the check state used by CheckTx, pending txs never
+// touch the deliver state because every election is copied
+func (app *DApplication) copyState() *DApplication {
+	cp := &DApplication{
+		db:         app.db,
+		elections:  make(map[string]*Election, len(app.elections)),
+		archive:    app.archive[:len(app.archive):len(app.archive)],
+		voteid:     app.voteid,
+		admins:     app.admins,
+		adminNonce: app.adminNonce,
+		chainID:    app.chainID,
+		depth:      app.depth,
+		cscaKeys:   app.cscaKeys,
+		csca:       app.csca,
+		height:     app.height,
+		blockTime:  app.blockTime,
+		check:      true,
+	}
+	for id, e := range app.elections {
+		cp.elections[id] = e.copy()
+	}
+	return cp
+}
 
-		_,err = verifier.ParseProof(proof1)
-		if err != nil {
-			return 1
-		}
+func (app *DApplication) deliverVote(trans Trans, tx []byte) ([]abcitypes.Event, error) {
+	e, err := app.election(trans.Election)
+	if err != nil {
+		return nil, err
+	}
+	// check if in vote period
+	vtime := app.blockTime
+	if vtime < e.voteStart || vtime > e.voteEnd{
+		return nil, ErrNotInVotePeriod
+	}
+	// verify(comm,pub)
+	pr, pub, err := e.parseVote(trans.Pdata)
+	if err != nil {
+		return nil, err
+	}
+	// every public signal is checked against chain state before the proof,
+	// the root and the election id only if the circuit outputs them
+	sig := e.signals
+	if sig.Election >= 0 && pub[sig.Election].Cmp(e.signal()) != 0 {
+		return nil, ErrWrongElection
+	}
+	//check if candidate exist or not?
+	name := string(pub[sig.Candidate].Bytes())
+	if _, ok := e.candidate[name]; !ok {
+		return nil, ErrCandidateNotFound
+	}
+	nullifier := pub[sig.Nullifier].String()
+	voted, err := e.voted.Has(nullifier)
+	if err != nil {
+		return nil, err
+	}
+	if voted {
+		return nil, ErrAlreadyVoted
+	}
+	// the proof must be made against one of the recent roots of the voter tree,
+	// this is checked on recheck too so stale proofs leave the mempool
+	if sig.Root >= 0 && !e.zktree.IsKnownRoot(pub[sig.Root]) {
+		return nil, ErrUnknownRoot
+	}
+	// every proof has its own verdict, so the code and the event of the tx
+	// tell whether the vote was counted. A recheck skips it, the proof was
+	// verified when the tx entered the mempool
+	if !app.recheck && !app.proofValid(tx, e, pr, pub) {
+		return nil, ErrVerificationFailed
+	}
+	// remember voter's hash(k), it stays buffered in e.voted until Commit so a
+	// second vote of the same block is rejected above
+	e.voted.Add(nullifier)
+	// add vote to candidate
+	e.candidate[name] += 1
+
+	// Event
+	events := []abcitypes.Event{
+		{
+			Type: "vote",
+			Attributes: []abcitypes.EventAttribute{
+				{Key: []byte("election"), Value: []byte(e.id), Index: true},
+				{Key: []byte("candidate"), Value: []byte(name), Index: false},
+				{Key: []byte("nullifier hash"), Value: []byte(nullifier), Index: false},
+				{Key: []byte("time"), Value: []byte(strconv.FormatInt(vtime,10)), Index: true},
+			},
+		},
+	}
+	return events, nil
+}
 
-		_,err = verifier.ParsePub(public1)
-		if err != nil{
-			return 1
-		}
-	} else if trans.Type == "register" {
-		// check trans.Vdata
-		verify := trans.Vdata
+func (app *DApplication) deliverRegister(trans Trans) ([]abcitypes.Event, error) {
+	e, err := app.election(trans.Election)
+	if err != nil {
+		return nil, err
+	}
+	// check if in register period
+	rtime := app.blockTime
+	if rtime < e.regStart || rtime > e.regEnd {
+		return nil, ErrNotInRegPeriod
+	}
 
-		verify1, err := json.Marshal(verify)
-		if err != nil {
-			return 1
-		}
+	// v1 = verify(DG15,SOD,CA)
+	// v2 = verify(authData,aaSig,DG15)
+	verify := trans.Vdata
+	verify1, err := json.Marshal(verify)
+	if err != nil {
+		return nil, ErrEncoding.Wrap(err)
+	}
+	ver, err := ParseVerify(verify1)
+	if err != nil {
+		return nil, ErrEncoding.Wrap(err)
+	}
 
-		_, err = ParseVerify(verify1)
+	used, err := e.used.Has(ver.Dg15)
+	if err != nil {
+		return nil, err
+	}
+	if used {
+		return nil, ErrKeyUsed
+	}
+	hash := new(big.Int)
+	_, ok := hash.SetString(ver.H,16)
+	if !ok || hash.Cmp(verifier.Tombstone) == 0 {
+		return nil, ErrInvalidLeaf
+	}
+	err = e.zktree.CheckLeaf(hash)
+	if err != nil {
+		return nil, treeError(err)
+	}
+	if e.zktree.Size()+len(e.pending) >= e.zktree.Capacity() {
+		return nil, ErrTreeFull.Wrap(fmt.Errorf("%d voters", e.zktree.Capacity()))
+	}
+	if !app.recheck {
+		err = verifyChip(ver, app.csca)
 		if err != nil {
-			return 1
+			return nil, err
 		}
-	} else if trans.Type == "admin"{
-		//TODO: check admin transaction
-	} else {
-		return 1
 	}
-	return 0
-} 
 
-func (app *DApplication) CheckTx(req abcitypes.RequestCheckTx) abcitypes.ResponseCheckTx {
-	code := app.isValid(req.Tx)
-
-	return abcitypes.ResponseCheckTx{Code: code, GasWanted: 1}
+	// pass verification, mark the key used and queue hash for zktree, the
+	// leaves of a block are inserted together in EndBlock. The check state
+	// queues them too so the mempool stops at the capacity of the tree
+	e.used.Add(ver.Dg15)
+	e.pending = append(e.pending, hash)
+
+	// Events
+	events := []abcitypes.Event{
+		{
+			Type: "register",
+			Attributes: []abcitypes.EventAttribute{
+				{Key: []byte("election"), Value: []byte(e.id), Index: true},
+				{Key: []byte("voter id"), Value: []byte(strconv.Itoa(e.voterid)), Index: true},
+				{Key: []byte("hash"), Value: []byte(ver.H), Index: false},
+				{Key: []byte("time"), Value: []byte(strconv.FormatInt(rtime,10)), Index: false},
+			},
+		},
+	}
+	e.voterid += 1
+	return events, nil
 }
 
-func (app *DApplication) DeliverTx(req abcitypes.RequestDeliverTx) abcitypes.ResponseDeliverTx {
-	var trans Trans
-	err := json.Unmarshal(req.Tx,&trans)
-	var events []abcitypes.Event
-
-	if (trans.Type == "vote"){
-		// check if in vote period
-		now := time.Now()
-		vtime := now.Unix()
-		if vtime < app.voteStart || vtime > app.voteEnd{
-			panic("Not in the voting period")
-		} 
-		// verify(comm,pub)
-		data := trans.Pdata
-		proof, public := data.Proof,data.Public
-		proof1, _ := json.Marshal(proof)
-		if err != nil {
-			panic(err)
-		}
-		public1, err := json.Marshal(public)
-		if err != nil {
-			panic(err)
-		}
-		pr, err := verifier.ParseProof(proof1)
-		if err != nil {
-			panic(err)
-		}
-		pub, err := verifier.ParsePub(public1)
-		if err != nil {
-			panic(err)
-		}
-		//check if candidate exist or not?
-		name := string(pub[0].Bytes())
-		if _, ok := app.candidate[name]; !ok {
-			panic("Candidate not found")
-		}
-		verifier1 := verifier.NewVerifier(app.verifyKey,pr,pub)
-		verify := verifier1.Verify()
-
-		if (verify == false) {
-			panic("Verification failed")
-		}else if(app.isVoted[pub[1].String()] != 0){
-			panic("This voter has already voted")
-		}else{
-			// set isVoted for voter's hash(k)
-			app.isVoted[pub[1].String()] = 1
-			// add vote to candidate
-			app.candidate[name] += 1
-		}
+func (app *DApplication) deliverAdmin(trans Trans) ([]abcitypes.Event, error) {
+	// time
+	atime := app.blockTime
+
+	// verify admin
+	err := app.verifyAdmin(trans)
+	if err != nil {
+		return nil, err
+	}
+
+	data := trans.Adata
+	switch data.Action {
+		case "", "setup":
+		case "finalize":
+			return app.finalizeElection(trans)
+		case "revoke":
+			return app.revokeVoter(trans)
+		default:
+			return nil, ErrAdminFailed.Wrap(fmt.Errorf("unknown action %q", data.Action))
+	}
 
-		// Event
-		events = []abcitypes.Event{
-			{
-				Type: "vote",
-				Attributes: []abcitypes.EventAttribute{
-					//TODO
-					{Key: []byte("candidate"), Value: []byte(name), Index: false},
-					{Key: []byte("nullifier hash"), Value: []byte(pub[1].String()), Index: false},
-					{Key: []byte("time"), Value: []byte(strconv.FormatInt(vtime,10)), Index: true},
-				},
+	// an election can only be set up again once its result is archived
+	if old, ok := app.elections[trans.Election]; ok && old.phase != PhaseFinalized {
+		return nil, ErrWrongPhase.Wrap(fmt.Errorf("election is %s", old.phase))
+	}
+	e, err := newElection(trans.Election, data, app.depth, app.db, app.voteid, atime)
+	if err != nil {
+		return nil, err
+	}
+	if old, ok := app.elections[e.id]; ok {
+		app.dropped = append(app.dropped, old.tree)
+	}
+	app.elections[e.id] = e
+	app.adminNonce = data.Nonce
+
+	events := []abcitypes.Event{
+		{
+			Type: "admin",
+			Attributes: []abcitypes.EventAttribute{
+				{Key: []byte("election"), Value: []byte(e.id), Index: true},
+				{Key: []byte("vote id"), Value: []byte(strconv.Itoa(app.voteid)), Index: true},
+				{Key: []byte("regstart"), Value: []byte(strconv.FormatInt(e.regStart,10)), Index: false},
+				{Key: []byte("regend"), Value: []byte(strconv.FormatInt(e.regEnd,10)), Index: false},
+				{Key: []byte("votestart"), Value: []byte(strconv.FormatInt(e.voteStart,10)), Index: false},
+				{Key: []byte("voteend"), Value: []byte(strconv.FormatInt(e.voteEnd,10)), Index: false},
+				{Key: []byte("time"), Value: []byte(strconv.FormatInt(atime,10)), Index: false},
 			},
-		}
-	} else if trans.Type == "register"{
-		// check if in register period
-		now := time.Now()
-		rtime := now.Unix()
-		fmt.Println(rtime)
-		fmt.Println(app.regEnd)
-		fmt.Println(app.regStart)
-		if rtime < app.regStart || rtime > app.regEnd {
-			panic("Not in the register period")
-		}
+		},
+	}
+	app.voteid += 1
+	return events, nil
+}
 
-		// v1 = verify(DG15,SOD,CA)
-		// v2 = verify(authData,aaSig,DG15)
-		verify := trans.Vdata
-		verify1, err := json.Marshal(verify)
-		if err != nil {
-			panic(err)
+func (app *DApplication) Commit() abcitypes.ResponseCommit {
+	app.height++
+	app.appHash = app.hash()
+
+	// persist state so the node can restart from this height
+	err := app.persist()
+	if err != nil {
+		panic(err)
+	}
+
+	// txs left in the mempool are rechecked against the new state
+	app.checkState = app.copyState()
+	app.verdicts = nil
+
+	if snapshotInterval > 0 && app.height%snapshotInterval == 0 {
+		state, err := app.snapshotState()
+		if err == nil {
+			err = app.takeSnapshot(state)
 		}
-		ver, err := ParseVerify(verify1)
 		if err != nil {
 			panic(err)
 		}
-		
-		tmp := v1_verify(ver.Dg15, ver.Sod)
-		if tmp == false{
-			panic("Tampered Chip")
-		}
-		tmp = v2_verify(ver.H, ver.AaSig, ver.Dg15)
-		if tmp == false{
-			panic("Cloning Chip")
-		}
+	}
+	return abcitypes.ResponseCommit{Data: app.appHash}
+}
 
- 		// pass verification, insert hash to zktree
-		if (app.isUsed[ver.Dg15] != 0){
-			panic("This pubkey has already used")
-		}else{
-			// insert h to zktree and set isUsed
-			hash := new(big.Int)
-			_, err := hash.SetString(ver.H,16)
-			if !err {
-				panic(err)
-			}
-			app.zktree.QuickInsert(hash)
-			app.isUsed[ver.Dg15] = 1
-
-			// append node to list of leaves
-			app.leafNode = append(app.leafNode,hash.String())
-			
-			// Events
-			events = []abcitypes.Event{
-				{
-					Type: "register",
-					Attributes: []abcitypes.EventAttribute{
-						{Key: []byte("voter id"), Value: []byte(strconv.Itoa(app.voterid)), Index: true},
-						{Key: []byte("hash"), Value: []byte(ver.H), Index: false},
-						{Key: []byte("time"), Value: []byte(strconv.FormatInt(rtime,10)), Index: false},
-					},
-				},
-			}
-			app.voterid += 1
-		}
-	} else if trans.Type == "admin"{
-		// time
-		now := time.Now()
-		atime := now.Unix()
-		
-		// get data
-		data := trans.Adata
-		vkey, cand := data.Vkey, data.Cand
-		vkey1, _ := json.Marshal(vkey)
-
-		// verify admin
-		hash := sha256.Sum256(vkey1)
-
-		if hash != app.vkeyHash {
-			panic("Admin verification failed")
-		}
+// Returns an associated value or nil if missing. Paths are "elections" or
+// "<election id>/<query>".
+func (app *DApplication) Query(reqQuery abcitypes.RequestQuery) (resQuery abcitypes.ResponseQuery) {
+	resQuery.Height = app.height
 
-		// reset zktree and zkroot, leafNode, id
-		app.zktree, err = verifier.NewZkTree(20, []*big.Int{})
-		if err != nil {
-			panic(err)
-		}
-		app.zkroot = nil
-		app.leafNode = nil
-		app.voterid = 0
-
-		// parse time
-		app.regStart, app.regEnd = data.RegStart, data.RegEnd
-		app.voteStart, app.voteEnd = data.VoteStart, data.VoteEnd
-		
-		// parse vkey
-		app.verifyKey, _ = verifier.ParseVk(vkey1)
-		
-		// parse candidate list
-		app.candidate = make(map[string]int64)
-		for i, name := range cand.Name {
-			app.candidate[name] = cand.Vote[i]
-		}
-		
-		// reset isUsed and isVoted
-		app.isUsed = make(map[string]int)
-		app.isVoted = make(map[string]int)
-
-		events = []abcitypes.Event{
-			{
-				Type: "admin",
-				Attributes: []abcitypes.EventAttribute{
-					{Key: []byte("vote id"), Value: []byte(strconv.Itoa(app.voteid)), Index: true},
-					{Key: []byte("regstart"), Value: []byte(strconv.FormatInt(app.regStart,10)), Index: false},
-					{Key: []byte("regend"), Value: []byte(strconv.FormatInt(app.regEnd,10)), Index: false},
-					{Key: []byte("votestart"), Value: []byte(strconv.FormatInt(app.voteStart,10)), Index: false},
-					{Key: []byte("voteend"), Value: []byte(strconv.FormatInt(app.voteEnd,10)), Index: false},
-					{Key: []byte("time"), Value: []byte(strconv.FormatInt(atime,10)), Index: false},
-				},
-			},
+	// results of finalized elections
+	if path, ok := strings.CutPrefix(reqQuery.Path, "archive/"); ok {
+		resQuery = app.queryArchive(path)
+		resQuery.Height = app.height
+		return resQuery
+	}
+
+	// list of elections
+	if reqQuery.Path == "elections" {
+		data := map[string]interface{}{
+			"elections": sortedKeys(app.elections),
 		}
-		app.voteid += 1
+		resQuery.Value, _ = json.Marshal(data)
+		return resQuery
 	}
-	return abcitypes.ResponseDeliverTx{Code: code.CodeTypeOK, Events: events}
-}
 
-func (app *DApplication) Commit() abcitypes.ResponseCommit {
-	app.height++
-	num := app.zktree.GetRoot()
-	app.zkroot = []byte(num.Text(16))
-	return abcitypes.ResponseCommit{}
-}
+	id, path, _ := strings.Cut(reqQuery.Path, "/")
+	e, ok := app.elections[id]
+	if !ok {
+		resQuery.Code = CodeTypeElectionNotFound
+		resQuery.Codespace = Codespace
+		resQuery.Log = "Election not found"
+		return resQuery
+	}
 
-// Returns an associated value or nil if missing.
-func (app *DApplication) Query(reqQuery abcitypes.RequestQuery) (resQuery abcitypes.ResponseQuery) {
-	switch reqQuery.Path{
-		// root of merkle tree
+	switch path{
+		// root of merkle tree, at the committed height of the query if set
 		case "root":
-			num := app.zktree.GetRoot()
+			num := e.zktree.GetRoot()
+			if reqQuery.Height != 0 && reqQuery.Height != app.height {
+				var err error
+				num, err = e.rootAt(app.db, reqQuery.Height, app.height)
+				if err != nil {
+					resQuery.Code, resQuery.Log = errorCode(err)
+					resQuery.Codespace = Codespace
+					break
+				}
+				resQuery.Height = reqQuery.Height
+			}
 			resQuery.Key = []byte("Root")
 			resQuery.Value = []byte(num.Text(16))
 
@@ -358,7 +445,7 @@ func (app *DApplication) Query(reqQuery abcitypes.RequestQuery) (resQuery abcity
 		case "total":
 			var sum int64
 			sum = 0  
-			for _, votes := range app.candidate {
+			for _, votes := range e.candidate {
 				sum += votes
 			}
 			resQuery.Key = []byte("Total vote")
@@ -367,9 +454,9 @@ func (app *DApplication) Query(reqQuery abcitypes.RequestQuery) (resQuery abcity
 		// number of votes of 1 candidate
 		case "candidate1":
 			name := string(reqQuery.Data)
-			if _, ok := app.candidate[name]; ok {
+			if _, ok := e.candidate[name]; ok {
 				resQuery.Key = []byte("Vote count")
-				resQuery.Value = []byte(fmt.Sprint(app.candidate[name]))
+				resQuery.Value = []byte(fmt.Sprint(e.candidate[name]))
 				resQuery.Log = "Candidate found"
 			} else {
 				resQuery.Log = "Candidate not found"
@@ -378,7 +465,7 @@ func (app *DApplication) Query(reqQuery abcitypes.RequestQuery) (resQuery abcity
 		// show candidate list
 		case "candidates":
 			var list []string
-			for name, _ := range app.candidate{
+			for name, _ := range e.candidate{
 				list = append(list,name)
 			}
 			data := map[string]interface{}{
@@ -390,7 +477,7 @@ func (app *DApplication) Query(reqQuery abcitypes.RequestQuery) (resQuery abcity
 		case "getResult":
 			var canlist []string
 			var numlist []int64
-			for name, num := range app.candidate{
+			for name, num := range e.candidate{
 				canlist = append(canlist,name)
 				numlist = append(numlist,num)
 			}
@@ -400,70 +487,143 @@ func (app *DApplication) Query(reqQuery abcitypes.RequestQuery) (resQuery abcity
 			}
 			resQuery.Value, _ = json.Marshal(data)
 
-		// get leaf of zktree
+		// phase of the election
+		case "phase":
+			data := map[string]interface{}{
+				"phase": e.phase,
+			}
+			resQuery.Value, _ = json.Marshal(data)
+
+		// get leaf of zktree, trees of more than maxLeafPage leaves must be
+		// read with "leaves"
 		case "getMerkleTree":
+			if e.zktree.Size() > maxLeafPage {
+				resQuery.Code, resQuery.Log = errorCode(ErrTooManyLeaves.Wrap(fmt.Errorf("%d leaves, at most %d", e.zktree.Size(), maxLeafPage)))
+				resQuery.Codespace = Codespace
+				break
+			}
+			leaves, err := e.leaves(0, e.zktree.Size())
+			if err != nil {
+				resQuery.Code, resQuery.Log = errorCode(err)
+				resQuery.Codespace = Codespace
+				break
+			}
 			data := map[string]interface{}{
-				"merkleTree": app.leafNode,
+				"merkleTree": leaves,
 			}
 			resQuery.Value, _ = json.Marshal(data)
 
-		// show path given an element
-		// case "path":
-		// 	hash := new(big.Int)
-		// 	_, err := hash.SetString(string(reqQuery.Data),16)
-		// 	if !err {
-		// 		resQuery.Log = "Convert to big number failed"
-		// 		break
-		// 	}
-		// 	// Debug
-		// 	// index := app.zktree.indexOf(hash)
-		// 	// tmp:= map[string] interface{}{
-		// 	// 	"index" : index,
-		// 	// 	"hash" : hash,
-		// 	// }
-		// 	// tmp1, _ := json.Marshal(tmp)
-		// 	ele, ind, _ := app.zktree.Path(app.zktree.IndexOf(hash))
-		// 	elej, _ := json.Marshal(ele)
-		// 	indj, _ := json.Marshal(ind)
-		// 	result := make(map[string]json.RawMessage)
-		// 	result["pathElements"] = json.RawMessage(elej)
-		// 	result["pathIndices"] = json.RawMessage(indj)	
-		// 	// result["index"] = json.RawMessage(tmp1)
-		// 	resQuery.Value, _ = json.MarshalIndent(result, "", "\t")
+		// merkle path of a leaf, Data is {"leaf": "<decimal>"} or {"index": n}
+		// so a voter can fetch the path without revealing its leaf
+		case "path":
+			var req struct{
+				Leaf string 	`json:"leaf"`
+				Index *int 	`json:"index"`
+			}
+			err := json.Unmarshal(reqQuery.Data, &req)
+			if err != nil {
+				resQuery.Code, resQuery.Log = errorCode(ErrEncoding.Wrap(err))
+				resQuery.Codespace = Codespace
+				break
+			}
+			inp, err := e.pathInput(req.Leaf, req.Index)
+			if err != nil {
+				resQuery.Code, resQuery.Log = errorCode(err)
+				resQuery.Codespace = Codespace
+				break
+			}
+			resQuery.Value, _ = json.Marshal(inp)
+
+		// one page of leaves, Data is {"start": n, "limit": m}
+		case "leaves":
+			var req struct{
+				Start int 	`json:"start"`
+				Limit int 	`json:"limit"`
+			}
+			if len(reqQuery.Data) > 0 {
+				err := json.Unmarshal(reqQuery.Data, &req)
+				if err != nil {
+					resQuery.Code, resQuery.Log = errorCode(ErrEncoding.Wrap(err))
+					resQuery.Codespace = Codespace
+					break
+				}
+			}
+			page, err := e.leafPage(req.Start, req.Limit, app.height)
+			if err != nil {
+				resQuery.Code, resQuery.Log = errorCode(err)
+				resQuery.Codespace = Codespace
+				break
+			}
+			resQuery.Value, _ = json.Marshal(page)
 		// show all leaf of zktree
 		// case "leaf":
 		// 	resQuery.Value, _ = json.MarshalIndent(app.leafNode,"", "\t")
 		default:
 	}
-	resQuery.Height = app.height
 	return resQuery
 }
 
-func (DApplication) InitChain(req abcitypes.RequestInitChain) abcitypes.ResponseInitChain {
-	return abcitypes.ResponseInitChain{}
-}
-
-func (DApplication) BeginBlock(req abcitypes.RequestBeginBlock) abcitypes.ResponseBeginBlock {
-	return abcitypes.ResponseBeginBlock{}
-}
-
-func (DApplication) EndBlock(req abcitypes.RequestEndBlock) abcitypes.ResponseEndBlock {
-	return abcitypes.ResponseEndBlock{}
-}
-
-func (DApplication) ListSnapshots(abcitypes.RequestListSnapshots) abcitypes.ResponseListSnapshots {
-	return abcitypes.ResponseListSnapshots{}
-}
+func (app *DApplication) InitChain(req abcitypes.RequestInitChain) abcitypes.ResponseInitChain {
+	var genesis GenesisState
+	if len(req.AppStateBytes) > 0 {
+		err := json.Unmarshal(req.AppStateBytes, &genesis)
+		if err != nil {
+			panic(fmt.Errorf("invalid app_state in genesis: %w", err))
+		}
+	}
+	err := genesis.validate()
+	if err != nil {
+		panic(fmt.Errorf("invalid app_state in genesis: %w", err))
+	}
+	app.admins = genesis.Admins
+	app.chainID = req.ChainId
+	app.cscaKeys = genesis.CSCA
+	app.csca, _ = parseCSCA(genesis.CSCA)
+	app.depth = genesis.Depth
+	if app.depth == 0 {
+		app.depth = defaultDepth
+	}
 
-func (DApplication) OfferSnapshot(abcitypes.RequestOfferSnapshot) abcitypes.ResponseOfferSnapshot {
-	return abcitypes.ResponseOfferSnapshot{}
+	// the first elections are part of genesis instead of admin txs
+	for _, ge := range genesis.Elections {
+		if _, ok := app.elections[ge.ID]; ok {
+			panic(fmt.Errorf("duplicate election %q in genesis", ge.ID))
+		}
+		e, err := newElection(ge.ID, ge.AData, app.depth, app.db, app.voteid, req.Time.Unix())
+		if err != nil {
+			panic(fmt.Errorf("invalid election %q in genesis: %w", ge.ID, err))
+		}
+		app.elections[e.id] = e
+		app.voteid += 1
+	}
+	app.checkState = app.copyState()
+	return abcitypes.ResponseInitChain{}
 }
 
-func (DApplication) LoadSnapshotChunk(abcitypes.RequestLoadSnapshotChunk) abcitypes.ResponseLoadSnapshotChunk {
-	return abcitypes.ResponseLoadSnapshotChunk{}
+func (app *DApplication) BeginBlock(req abcitypes.RequestBeginBlock) abcitypes.ResponseBeginBlock {
+	// election windows are checked against the block time so every validator
+	// and every replay of the block agree on the result
+	app.blockTime = req.Header.Time.Unix()
+	events := app.advancePhases()
+
+	// the votes of the block are verified in one batch per election, DeliverTx
+	// reads the verdict of each tx
+	app.verdicts = nil
+	if app.blockTxs != nil {
+		if txs := app.blockTxs(req.Header.Height); txs != nil {
+			app.verifyBlockVotes(txs)
+		}
+	}
+	return abcitypes.ResponseBeginBlock{Events: events}
 }
 
-func (DApplication) ApplySnapshotChunk(abcitypes.RequestApplySnapshotChunk) abcitypes.ResponseApplySnapshotChunk {
-	return abcitypes.ResponseApplySnapshotChunk{}
+func (app *DApplication) EndBlock(req abcitypes.RequestEndBlock) abcitypes.ResponseEndBlock {
+	// insert the registrations of this block, one root update per election.
+	// DeliverTx already rejected leaves the tree can not take, an error here
+	// means the database failed
+	rootEvents, err := app.insertPending()
+	if err != nil {
+		panic(err)
+	}
+	return abcitypes.ResponseEndBlock{Events: rootEvents}
 }
-
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	dbm "github.com/tendermint/tm-db"
+	"zkvoting/verifier"
+)
+
+const testChainID = "test-chain"
+
+// t0 is the time of the first block of the test chains
+const t0 = 1700000000
+
+// testBlock is one block of a test chain, its header time and txs
+type testBlock struct {
+	time int64
+	txs  [][]byte
+}
+
+// testChain drives an application block by block the way tendermint does
+type testChain struct {
+	t     *testing.T
+	app   *DApplication
+	admin ed25519.PrivKey
+	nonce uint64
+}
+
+// testGenesis is the app_state of the test network with admin as its only admin
+func testGenesis(t *testing.T, admin ed25519.PrivKey) GenesisState {
+	bz, err := os.ReadFile("mytestnet/node0/config/genesis.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		AppState GenesisState `json:"app_state"`
+	}
+	err = json.Unmarshal(bz, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.AppState.Admins = [][]byte{admin.PubKey().Bytes()}
+	// the tests set up their own elections, TestTestnetGenesis runs the
+	// election of the testnet
+	doc.AppState.Elections = nil
+	return doc.AppState
+}
+
+func newTestChain(t *testing.T, db dbm.DB, admin ed25519.PrivKey) *testChain {
+	genesis, err := json.Marshal(testGenesis(t, admin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := NewDApplication(db)
+	app.InitChain(abcitypes.RequestInitChain{
+		Time:          time.Unix(t0, 0),
+		ChainId:       testChainID,
+		AppStateBytes: genesis,
+	})
+	return &testChain{t: t, app: app, admin: admin}
+}
+
+// block runs one block and returns the result of every tx
+func (c *testChain) block(b testBlock) []abcitypes.ResponseDeliverTx {
+	// like the block store of a node, the txs are known before the block runs
+	c.app.blockTxs = func(int64) [][]byte { return b.txs }
+	c.app.BeginBlock(abcitypes.RequestBeginBlock{Header: tmproto.Header{Time: time.Unix(b.time, 0)}})
+	res := make([]abcitypes.ResponseDeliverTx, len(b.txs))
+	for i, tx := range b.txs {
+		res[i] = c.app.DeliverTx(abcitypes.RequestDeliverTx{Tx: tx})
+	}
+	c.app.EndBlock(abcitypes.RequestEndBlock{})
+	c.app.Commit()
+	return res
+}
+
+// adminTx signs data for election with the next admin nonce
+func (c *testChain) adminTx(election string, data AData) []byte {
+	c.nonce++
+	data.Nonce = c.nonce
+	msg, err := adminSignBytes(testChainID, election, data)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	sig, err := c.admin.Sign(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	tx, err := json.Marshal(Trans{Type: "admin", Election: election, Adata: data, PubKey: c.admin.PubKey().Bytes(), Sig: sig})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return tx
+}
+
+// testElection sets up an election with the sample key and candidates,
+// registration is open in [t0+10, t0+100] and voting in [t0+50, t0+200]
+func testElection(t *testing.T) AData {
+	vkey, err := os.ReadFile("test/verification_key.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the sample circuit only outputs the candidate and the nullifier
+	var fields map[string]interface{}
+	err = json.Unmarshal(vkey, &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields["signals"] = []string{verifier.SignalCandidate, verifier.SignalNullifier}
+	vkey, err = json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cand, err := os.ReadFile("test/candidates.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := AData{
+		Vkey:      vkey,
+		RegStart:  t0 + 10,
+		RegEnd:    t0 + 100,
+		VoteStart: t0 + 50,
+		VoteEnd:   t0 + 200,
+	}
+	err = json.Unmarshal(cand, &data.Cand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// registerTx registers the sample passport in election
+func registerTx(t *testing.T, election string) []byte {
+	bz, err := os.ReadFile("test/data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v Verify
+	err = json.Unmarshal(bz, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := json.Marshal(Trans{Type: "register", Election: election, Vdata: v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// voteTx is a vote in election with the sample proof and the given public
+// signals, those of the sample proof if public is nil
+func voteTx(t *testing.T, election string, public []string) []byte {
+	proof, err := os.ReadFile("test/proof.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public == nil {
+		bz, err := os.ReadFile("test/public.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.Unmarshal(bz, &public)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx, err := json.Marshal(Trans{Type: "vote", Election: election, Pdata: PData{Proof: proof, Public: public}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// TestReplayAfterWindowsClose runs a chain through an election and replays
+// its blocks on a new node long after every window closed. The windows are
+// checked against the header time, so the replay gets the same result for
+// every tx and the same app hash at every height
+func TestReplayAfterWindowsClose(t *testing.T) {
+	admin := ed25519.GenPrivKey()
+	chain := newTestChain(t, dbm.NewMemDB(), admin)
+	setup := chain.adminTx("e", testElection(t))
+	finalize := chain.adminTx("e", AData{Action: "finalize"})
+	reg := registerTx(t, "e")
+	vote := voteTx(t, "e", nil)
+
+	blocks := []testBlock{
+		{t0, [][]byte{setup}},
+		{t0 + 5, [][]byte{reg}},
+		{t0 + 20, [][]byte{reg}},
+		{t0 + 30, [][]byte{vote}},
+		{t0 + 60, [][]byte{vote}},
+		{t0 + 300, [][]byte{reg, vote}},
+		{t0 + 301, [][]byte{finalize}},
+	}
+	want := []uint32{
+		CodeTypeOK,
+		CodeTypeNotInRegPeriod,
+		CodeTypeOK,
+		CodeTypeNotInVotePeriod,
+		CodeTypeOK,
+		CodeTypeNotInRegPeriod, CodeTypeNotInVotePeriod,
+		CodeTypeOK,
+	}
+
+	var codes []uint32
+	var hashes [][]byte
+	for _, b := range blocks {
+		for _, res := range chain.block(b) {
+			codes = append(codes, res.Code)
+		}
+		hashes = append(hashes, chain.app.appHash)
+	}
+	if len(codes) != len(want) {
+		t.Fatalf("got %d results, want %d", len(codes), len(want))
+	}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Errorf("tx %d: got code %d, want %d", i, codes[i], want[i])
+		}
+	}
+	if phase := chain.app.elections["e"].phase; phase != PhaseFinalized {
+		t.Fatalf("election is %s after the replay, want finalized", phase)
+	}
+
+	replay := newTestChain(t, dbm.NewMemDB(), admin)
+	i := 0
+	for h, b := range blocks {
+		for _, res := range replay.block(b) {
+			if res.Code != codes[i] {
+				t.Errorf("replayed tx %d: got code %d, want %d", i, res.Code, codes[i])
+			}
+			i++
+		}
+		if !bytes.Equal(replay.app.appHash, hashes[h]) {
+			t.Fatalf("height %d: replayed app hash %X, want %X", h+1, replay.app.appHash, hashes[h])
+		}
+	}
+}
+
+func TestAdminWindows(t *testing.T) {
+	cases := []struct {
+		name string
+		edit func(*AData)
+		code uint32
+	}{
+		{"valid", func(*AData) {}, CodeTypeOK},
+		{"registration ends before it starts", func(d *AData) { d.RegEnd = d.RegStart - 1 }, CodeTypeInvalidWindow},
+		{"voting ends before it starts", func(d *AData) { d.VoteEnd = d.VoteStart - 1 }, CodeTypeInvalidWindow},
+		{"voting starts before registration", func(d *AData) { d.VoteStart = d.RegStart - 1 }, CodeTypeInvalidWindow},
+		{"voting ends before registration", func(d *AData) { d.VoteEnd = d.RegEnd - 1 }, CodeTypeInvalidWindow},
+		{"registration already over", func(d *AData) { d.RegStart, d.RegEnd = t0-100, t0-1 }, CodeTypeInvalidWindow},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			chain := newTestChain(t, dbm.NewMemDB(), ed25519.GenPrivKey())
+			data := testElection(t)
+			tc.edit(&data)
+			res := chain.block(testBlock{t0, [][]byte{chain.adminTx("e", data)}})
+			if res[0].Code != tc.code {
+				t.Fatalf("got code %d (%s), want %d", res[0].Code, res[0].Log, tc.code)
+			}
+		})
+	}
+}
+
+func TestVoteSignalsOutOfField(t *testing.T) {
+	chain := newTestChain(t, dbm.NewMemDB(), ed25519.GenPrivKey())
+	key := newTrapdoorKey(t)
+	data := testElection(t)
+	data.Vkey = key.vkey()
+	chain.block(testBlock{t0, [][]byte{chain.adminTx("e", data)}})
+
+	r := verifier.FieldSize
+	e := chain.app.elections["e"]
+	// the signals are rejected before the proof is looked at
+	proof := key.prove([]*big.Int{big.NewInt(65), big.NewInt(7), e.zktree.GetRoot(), e.signal()})
+	root, election := e.zktree.GetRoot().String(), e.signal().String()
+	plusR := new(big.Int).Add(big.NewInt(7), r).String()
+	for _, public := range [][]string{
+		{"65", plusR, root, election},
+		{"65", "-7", root, election},
+		{"65", "7", new(big.Int).Add(e.zktree.GetRoot(), r).String(), election},
+	} {
+		tx, err := json.Marshal(Trans{Type: "vote", Election: "e", Pdata: PData{Proof: proof, Public: public}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := chain.block(testBlock{t0 + 60, [][]byte{tx}})
+		if res[0].Code != CodeTypeEncodingError {
+			t.Errorf("%v: got code %d (%s), want %d", public, res[0].Code, res[0].Log, CodeTypeEncodingError)
+		}
+	}
+}
+
+func TestGetMerkleTreeCap(t *testing.T) {
+	chain := newTestChain(t, dbm.NewMemDB(), ed25519.GenPrivKey())
+	chain.block(testBlock{t0, [][]byte{chain.adminTx("e", testElection(t))}})
+	query := abcitypes.RequestQuery{Path: "e/getMerkleTree"}
+
+	e := chain.app.elections["e"]
+	leaves := make([]*big.Int, maxLeafPage)
+	for i := range leaves {
+		leaves[i] = big.NewInt(int64(i + 1))
+	}
+	_, err := e.zktree.BatchInsert(leaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := chain.app.Query(query)
+	if res.Code != CodeTypeOK {
+		t.Fatalf("%d leaves: code %d (%s)", maxLeafPage, res.Code, res.Log)
+	}
+	var tree struct {
+		MerkleTree []string `json:"merkleTree"`
+	}
+	err = json.Unmarshal(res.Value, &tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.MerkleTree) != maxLeafPage {
+		t.Fatalf("got %d leaves, want %d", len(tree.MerkleTree), maxLeafPage)
+	}
+
+	_, err = e.zktree.QuickInsert(big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = chain.app.Query(query)
+	if res.Code != CodeTypeTooManyLeaves || res.Codespace != Codespace || res.Value != nil {
+		t.Fatalf("%d leaves: got code %d in %q, want %d", maxLeafPage+1, res.Code, res.Codespace, CodeTypeTooManyLeaves)
+	}
+}
+
+// TestTestnetGenesis starts a node from the genesis of the four node testnet
+// and counts the sample proof in its election
+func TestTestnetGenesis(t *testing.T) {
+	bz, err := os.ReadFile("mytestnet/node0/config/genesis.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		ChainID  string          `json:"chain_id"`
+		AppState json.RawMessage `json:"app_state"`
+	}
+	err = json.Unmarshal(bz, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := NewDApplication(dbm.NewMemDB())
+	app.InitChain(abcitypes.RequestInitChain{Time: time.Unix(t0, 0), ChainId: doc.ChainID, AppStateBytes: doc.AppState})
+	chain := &testChain{t: t, app: app}
+	e, ok := app.elections["default"]
+	if !ok {
+		t.Fatal("the testnet starts without its election")
+	}
+	votes := e.candidate["{"]
+
+	res := chain.block(testBlock{t0 + 1, [][]byte{voteTx(t, "default", nil)}})
+	if res[0].Code != CodeTypeOK {
+		t.Fatalf("sample vote: code %d (%s)", res[0].Code, res[0].Log)
+	}
+	if got := app.elections["default"].candidate["{"]; got != votes+1 {
+		t.Fatalf("candidate has %d votes, want %d", got, votes+1)
+	}
+}
+
+// TestVoteAfterRestart reopens the database of a node, the election must
+// read the public signals of its key the same way
+func TestVoteAfterRestart(t *testing.T) {
+	db := dbm.NewMemDB()
+	chain := newTestChain(t, db, ed25519.GenPrivKey())
+	chain.block(testBlock{t0, [][]byte{chain.adminTx("e", testElection(t))}})
+
+	chain.app = NewDApplication(db)
+	res := chain.block(testBlock{t0 + 60, [][]byte{voteTx(t, "e", nil)}})
+	if res[0].Code != CodeTypeOK {
+		t.Fatalf("vote after restart: code %d (%s)", res[0].Code, res[0].Log)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+
+	"github.com/tendermint/tendermint/crypto/merkle"
+)
+
+// The app hash is the merkle root of these sections, each one encoded with
+// sorted keys and length prefixes so it never depends on map iteration order.
+// A validator whose state diverges commits a different hash and halts on the
+// next block instead of drifting away from the network.
+
+// hashEncoder builds the deterministic byte encoding of one section
+type hashEncoder struct {
+	buf []byte
+}
+
+func (e *hashEncoder) putBytes(b []byte) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *hashEncoder) putString(s string) {
+	e.putBytes([]byte(s))
+}
+
+func (e *hashEncoder) putInt64(n int64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(n))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hash computes the app hash, one leaf per election in id order, a leaf for
+// the archive of finalized results and a last leaf for the chain configuration
+func (app *DApplication) hash() []byte {
+	ids := sortedKeys(app.elections)
+	leaves := make([][]byte, 0, len(ids)+1)
+	for _, id := range ids {
+		leaves = append(leaves, app.elections[id].hash())
+	}
+
+	// archived results in the order they were finalized
+	var archive hashEncoder
+	for _, r := range app.archive {
+		archive.putString(r.ID)
+		archive.putInt64(r.Height)
+		archive.putInt64(int64(len(r.Candidates)))
+		for i, name := range r.Candidates {
+			archive.putString(name)
+			archive.putInt64(r.Votes[i])
+		}
+		archive.putString(r.Root)
+		archive.putInt64(int64(r.Voters))
+		archive.putInt64(int64(r.Nullifiers))
+		archive.putString(r.VkeyHash)
+	}
+	leaves = append(leaves, archive.buf)
+
+	// chain configuration: admin keys, replay nonce, tree depth and CSCA keys
+	var admin hashEncoder
+	admin.putString(app.chainID)
+	admin.putInt64(int64(len(app.admins)))
+	for _, key := range app.admins {
+		admin.putBytes(key)
+	}
+	admin.putInt64(int64(app.adminNonce))
+	admin.putInt64(int64(app.depth))
+	admin.putInt64(int64(app.voteid))
+	admin.putInt64(int64(len(app.cscaKeys)))
+	for _, key := range app.cscaKeys {
+		admin.putString(key.Curve)
+		admin.putString(key.X)
+		admin.putString(key.Y)
+	}
+	leaves = append(leaves, admin.buf)
+
+	return merkle.HashFromByteSlices(leaves)
+}
+
+// hash computes the merkle root over the state of one election
+func (e *Election) hash() []byte {
+	// voter tree: its id in the database, size and root history. Votes are
+	// accepted against any root of the history, so a restored node must not
+	// take it on trust
+	var root hashEncoder
+	root.putString(e.id)
+	root.putInt64(int64(e.tree))
+	root.putInt64(int64(e.zktree.Size()))
+	roots, current := e.zktree.History()
+	root.putInt64(int64(len(roots)))
+	for _, num := range roots {
+		if num == nil {
+			root.putBytes(nil)
+			continue
+		}
+		root.putBytes(num.Bytes())
+	}
+	root.putInt64(int64(current))
+	root.putInt64(int64(e.voterid))
+
+	// candidate tallies
+	var cand hashEncoder
+	for _, name := range sortedKeys(e.candidate) {
+		cand.putString(name)
+		cand.putInt64(e.candidate[name])
+	}
+
+	// nullifier set and used DG15 keys, their hashes are updated with every
+	// add so the sets are never read here
+	var voted hashEncoder
+	voted.putInt64(int64(e.voted.size))
+	voted.putBytes(e.voted.hash)
+
+	var used hashEncoder
+	used.putInt64(int64(e.used.size))
+	used.putBytes(e.used.hash)
+
+	// election phase, tree hash, schedule and verification key
+	var sched hashEncoder
+	sched.putString(string(e.phase))
+	sched.putString(e.hasher)
+	sched.putInt64(int64(e.depth))
+	sched.putInt64(e.regStart)
+	sched.putInt64(e.regEnd)
+	sched.putInt64(e.voteStart)
+	sched.putInt64(e.voteEnd)
+	vkeyHash := sha256.Sum256(e.vkeyJSON)
+	sched.putBytes(vkeyHash[:])
+
+	return merkle.HashFromByteSlices([][]byte{
+		root.buf,
+		cand.buf,
+		voted.buf,
+		used.buf,
+		sched.buf,
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+)
+
+// Phase is the stage an election is in. Setup, registration, voting and
+// closed follow the block time, finalized is set by an admin transaction
+type Phase string
+
+const (
+	PhaseSetup        Phase = "setup"
+	PhaseRegistration Phase = "registration"
+	PhaseVoting       Phase = "voting"
+	PhaseClosed       Phase = "closed"
+	PhaseFinalized    Phase = "finalized"
+)
+
+var phaseOrder = map[Phase]int{
+	PhaseSetup:        0,
+	PhaseRegistration: 1,
+	PhaseVoting:       2,
+	PhaseClosed:       3,
+	PhaseFinalized:    4,
+}
+
+// ElectionRecord is the frozen result of a finalized election, records are
+// never changed or removed once written
+type ElectionRecord struct {
+	ID         string   `json:"id"`
+	Height     int64    `json:"height"`
+	Candidates []string `json:"candidates"`
+	Votes      []int64  `json:"votes"`
+	Root       string   `json:"root"`
+	Voters     int      `json:"voters"`
+	Nullifiers int      `json:"nullifiers"`
+	VkeyHash   string   `json:"vkeyhash"`
+}
+
+// advance moves the election to the phase of block time t, phases only move
+// forward so a block with an older time never reopens an election
+func (e *Election) advance(t int64) bool {
+	next := PhaseSetup
+	switch {
+	case t > e.regEnd && t > e.voteEnd:
+		next = PhaseClosed
+	case t >= e.voteStart:
+		next = PhaseVoting
+	case t >= e.regStart:
+		next = PhaseRegistration
+	}
+	if phaseOrder[next] <= phaseOrder[e.phase] {
+		return false
+	}
+	e.phase = next
+	return true
+}
+
+// record freezes the current result of the election
+func (e *Election) record(height int64) ElectionRecord {
+	r := ElectionRecord{
+		ID:         e.id,
+		Height:     height,
+		Candidates: sortedKeys(e.candidate),
+		Voters:     e.voterid,
+		Nullifiers: e.voted.size,
+	}
+	for _, name := range r.Candidates {
+		r.Votes = append(r.Votes, e.candidate[name])
+	}
+	if num := e.zktree.GetRoot(); num != nil {
+		r.Root = num.String()
+	}
+	vkeyHash := sha256.Sum256(e.vkeyJSON)
+	r.VkeyHash = hex.EncodeToString(vkeyHash[:])
+	return r
+}
+
+// advancePhases moves every election to the phase of the block time and
+// returns one event per election that changed phase
+func (app *DApplication) advancePhases() []abcitypes.Event {
+	var events []abcitypes.Event
+	for _, id := range sortedKeys(app.elections) {
+		e := app.elections[id]
+		if !e.advance(app.blockTime) {
+			continue
+		}
+		events = append(events, abcitypes.Event{
+			Type: "phase",
+			Attributes: []abcitypes.EventAttribute{
+				{Key: []byte("election"), Value: []byte(e.id), Index: true},
+				{Key: []byte("phase"), Value: []byte(e.phase), Index: true},
+			},
+		})
+	}
+	return events
+}
+
+// finalizeElection archives the result of a closed election
+func (app *DApplication) finalizeElection(trans Trans) ([]abcitypes.Event, error) {
+	e, err := app.election(trans.Election)
+	if err != nil {
+		return nil, err
+	}
+	if e.phase != PhaseClosed {
+		return nil, ErrWrongPhase.Wrap(fmt.Errorf("election is %s", e.phase))
+	}
+	e.phase = PhaseFinalized
+	// the record belongs to the block being executed
+	r := e.record(app.height + 1)
+	app.archive = append(app.archive, r)
+	app.adminNonce = trans.Adata.Nonce
+
+	events := []abcitypes.Event{
+		{
+			Type: "finalize",
+			Attributes: []abcitypes.EventAttribute{
+				{Key: []byte("election"), Value: []byte(e.id), Index: true},
+				{Key: []byte("height"), Value: []byte(strconv.FormatInt(r.Height, 10)), Index: true},
+				{Key: []byte("root"), Value: []byte(r.Root), Index: false},
+				{Key: []byte("nullifiers"), Value: []byte(strconv.Itoa(r.Nullifiers)), Index: false},
+			},
+		},
+	}
+	return events, nil
+}
+
+// queryArchive answers "archive/<election id>" with every record of the
+// election and "archive/<election id>/<height>" with the record at that height
+func (app *DApplication) queryArchive(path string) (resQuery abcitypes.ResponseQuery) {
+	id, h, hasHeight := strings.Cut(path, "/")
+	var height int64
+	if hasHeight {
+		var err error
+		height, err = strconv.ParseInt(h, 10, 64)
+		if err != nil {
+			resQuery.Code, resQuery.Log = errorCode(ErrEncoding.Wrap(err))
+			resQuery.Codespace = Codespace
+			return resQuery
+		}
+	}
+
+	records := []ElectionRecord{}
+	for _, r := range app.archive {
+		if r.ID == id && (!hasHeight || r.Height == height) {
+			records = append(records, r)
+		}
+	}
+	if len(records) == 0 {
+		resQuery.Code, resQuery.Log = errorCode(ErrRecordNotFound)
+		resQuery.Codespace = Codespace
+		return resQuery
+	}
+
+	if hasHeight {
+		resQuery.Value, _ = json.Marshal(records[0])
+	} else {
+		resQuery.Value, _ = json.Marshal(map[string]interface{}{"records": records})
+	}
+	return resQuery
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	dbm "github.com/tendermint/tm-db"
+	"zkvoting/verifier"
+)
+
+// Election is one election on the chain. Each election has its own voter
+// tree, nullifier set, verification key, candidates and windows so several
+// of them can run side by side
+type Election struct {
+	id        string                // election id
+	phase     Phase                 // current phase
+	zktree    *verifier.ZkTree      // voter merkle tree
+	candidate map[string]int64      // candidate list
+	voted     *keySet               // nullifiers of counted votes
+	used      *keySet               // Dg15.pubkey of registered voters
+	tree      int                   // id of the voter tree in the database
+	hasher    string                // hash of the voter tree
+	depth     int                   // depth of the voter tree
+	store     *treeStore            // nodes of zktree
+	pending   []*big.Int            // leaves registered in this block, inserted in EndBlock
+	revoked   map[int]bool          // voters revoked by txs in the mempool, check state only
+	voterid   int                   // number of voter
+	verifyKey verifier.VerifyingKey // verification key, plonk or groth16, parsed once with what its proofs share
+	signals   verifier.Signals      // position of each public signal of the vote circuit
+	vkeyJSON  []byte                // verification key as submitted by admin
+	regStart  int64                 // register start
+	regEnd    int64                 // register end
+	voteStart int64                 // vote start
+	voteEnd   int64                 // vote end
+}
+
+// validElectionID rejects ids that can not be used in a query path or do not
+// fit in one public signal of the vote circuit
+func validElectionID(id string) error {
+	if id == "" || len(id) > 31 || strings.Contains(id, "/") || id == "elections" || id == "archive" {
+		return ErrInvalidElection.Wrap(fmt.Errorf("%q", id))
+	}
+	return nil
+}
+
+// checkWindows rejects windows that end before they start, voting that
+// opens before registration or closes before it, and registration that is
+// already over at block time now
+func checkWindows(data AData, now int64) error {
+	switch {
+	case data.RegStart > data.RegEnd || data.VoteStart > data.VoteEnd:
+		return ErrInvalidWindow.Wrap(fmt.Errorf("a window ends before it starts"))
+	case data.VoteStart < data.RegStart || data.VoteEnd < data.RegEnd:
+		return ErrInvalidWindow.Wrap(fmt.Errorf("voting must not start or end before registration"))
+	case data.RegEnd < now:
+		return ErrInvalidWindow.Wrap(fmt.Errorf("registration ended at %d, block time is %d", data.RegEnd, now))
+	}
+	return nil
+}
+
+// newElection builds an empty election described by data at block time now,
+// its voter tree is stored in db under tree. depth is used when data does not
+// set one
+func newElection(id string, data AData, depth int, db dbm.DB, tree int, now int64) (*Election, error) {
+	err := validElectionID(id)
+	if err != nil {
+		return nil, err
+	}
+	err = checkWindows(data, now)
+	if err != nil {
+		return nil, err
+	}
+	vkey, cand := data.Vkey, data.Cand
+	vkey1, err := json.Marshal(vkey)
+	if err != nil {
+		return nil, ErrEncoding.Wrap(err)
+	}
+	verifyKey, err := verifier.ParseVerifyingKey(vkey1)
+	if err != nil {
+		return nil, ErrInvalidVkey.Wrap(err)
+	}
+	signals, err := verifier.SignalLayout(verifyKey.SignalNames(), verifyKey.PublicInputs())
+	if err != nil {
+		return nil, ErrInvalidVkey.Wrap(err)
+	}
+	if data.Depth != 0 {
+		depth = data.Depth
+	}
+	if depth < 1 || depth > maxDepth {
+		return nil, ErrInvalidDepth.Wrap(fmt.Errorf("%d", depth))
+	}
+	// a proof from a circuit built for another depth can never match the root.
+	// snarkjs does not write levels, so an election that sets its own depth
+	// must add it to the key. With the genesis depth it is only checked when
+	// the key has it
+	if data.Depth != 0 && verifyKey.TreeLevels() == 0 {
+		return nil, ErrInvalidDepth.Wrap(fmt.Errorf("the verification key must declare the levels of its circuit to set depth %d", depth))
+	}
+	if verifyKey.TreeLevels() != 0 && verifyKey.TreeLevels() != depth {
+		return nil, ErrInvalidDepth.Wrap(fmt.Errorf("circuit is built for depth %d, election uses %d", verifyKey.TreeLevels(), depth))
+	}
+	if len(cand.Name) != len(cand.Vote) {
+		return nil, ErrInvalidCandidates
+	}
+	hasher, err := verifier.NewHasher(data.Hasher)
+	if err != nil {
+		return nil, ErrInvalidHasher.Wrap(err)
+	}
+	store := newTreeStore(db, tree)
+	zktree, err := verifier.NewZkTreeWithStore(depth, store, hasher)
+	if err != nil {
+		return nil, treeError(err)
+	}
+
+	e := &Election{
+		id:        id,
+		phase:     PhaseSetup,
+		zktree:    zktree,
+		tree:      tree,
+		hasher:    data.Hasher,
+		depth:     depth,
+		store:     store,
+		candidate: make(map[string]int64),
+		voted:     newKeySet(db, votedSet, tree, 0, nil),
+		used:      newKeySet(db, usedSet, tree, 0, nil),
+		verifyKey: verifyKey,
+		signals:   signals,
+		vkeyJSON:  vkey1,
+		regStart:  data.RegStart,
+		regEnd:    data.RegEnd,
+		voteStart: data.VoteStart,
+		voteEnd:   data.VoteEnd,
+	}
+	for i, name := range cand.Name {
+		e.candidate[name] = cand.Vote[i]
+	}
+	return e, nil
+}
+
+// copy returns the election as seen by the check state, the tallies are
+// copied, the key sets buffer their own adds and zktree and verifyKey are
+// shared because the check state never inserts. Its pending leaves only
+// count the registrations in the mempool against the tree capacity
+func (e *Election) copy() *Election {
+	cp := *e
+	cp.pending = e.pending[:len(e.pending):len(e.pending)]
+	cp.revoked = make(map[int]bool)
+	cp.candidate = make(map[string]int64, len(e.candidate))
+	for name, votes := range e.candidate {
+		cp.candidate[name] = votes
+	}
+	cp.voted = e.voted.copy()
+	cp.used = e.used.copy()
+	return &cp
+}
+
+// insertPending adds the leaves registered in this block to the voter trees
+// and returns one event per election whose root changed
+func (app *DApplication) insertPending() ([]abcitypes.Event, error) {
+	var events []abcitypes.Event
+	for _, id := range sortedKeys(app.elections) {
+		e := app.elections[id]
+		if len(e.pending) == 0 {
+			continue
+		}
+		first, err := e.zktree.BatchInsert(e.pending)
+		if err != nil {
+			return nil, fmt.Errorf("election %q: %w", id, err)
+		}
+		events = append(events, abcitypes.Event{
+			Type: "root",
+			Attributes: []abcitypes.EventAttribute{
+				{Key: []byte("election"), Value: []byte(e.id), Index: true},
+				{Key: []byte("root"), Value: []byte(e.zktree.GetRoot().String()), Index: true},
+				{Key: []byte("first leaf"), Value: []byte(strconv.Itoa(first)), Index: false},
+				{Key: []byte("leaves"), Value: []byte(strconv.Itoa(len(e.pending))), Index: false},
+			},
+		})
+		e.pending = nil
+	}
+	return events, nil
+}
+
+// leaves reads the leaves of the voter tree in [start, end) as decimal strings
+func (e *Election) leaves(start, end int) ([]string, error) {
+	leaves := make([]string, end-start)
+	for i := range leaves {
+		leaf, err := e.zktree.Leaf(start + i)
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = leaf.String()
+	}
+	return leaves, nil
+}
+
+// maxLeafPage is the most leaves a "leaves" query returns
+const maxLeafPage = 1000
+
+// LeafPage is one page of the leaves of a voter tree. Depth, hasher and root
+// let an auditor rebuild the tree from all pages and check the root
+type LeafPage struct {
+	Election string   `json:"election"`
+	Height   int64    `json:"height"`
+	Depth    int      `json:"depth"`
+	Hasher   string   `json:"hasher"`
+	Size     int      `json:"size"`
+	Root     string   `json:"root"`
+	Start    int      `json:"start"`
+	Leaves   []string `json:"leaves"`
+}
+
+// leafPage returns up to limit leaves from start, maxLeafPage if limit is 0
+func (e *Election) leafPage(start, limit int, height int64) (*LeafPage, error) {
+	if limit <= 0 || limit > maxLeafPage {
+		limit = maxLeafPage
+	}
+	size := e.zktree.Size()
+	if start < 0 || start > size {
+		return nil, ErrLeafNotFound.Wrap(fmt.Errorf("start %d of %d leaves", start, size))
+	}
+	end := start + limit
+	if end > size {
+		end = size
+	}
+	leaves, err := e.leaves(start, end)
+	if err != nil {
+		return nil, treeError(err)
+	}
+	hasher := e.hasher
+	if hasher == "" {
+		hasher = verifier.HashMimcSponge
+	}
+	return &LeafPage{
+		Election: e.id,
+		Height:   height,
+		Depth:    e.depth,
+		Hasher:   hasher,
+		Size:     size,
+		Root:     e.zktree.GetRoot().String(),
+		Start:    start,
+		Leaves:   leaves,
+	}, nil
+}
+
+// rootAt is the root of the voter tree committed at height
+func (e *Election) rootAt(db dbm.DB, height, latest int64) (*big.Int, error) {
+	if height < 0 || height > latest {
+		return nil, ErrRootNotFound.Wrap(fmt.Errorf("height %d, latest is %d", height, latest))
+	}
+	root, err := rootAt(db, e.tree, height)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, ErrRootNotFound.Wrap(fmt.Errorf("height %d", height))
+	}
+	return root, nil
+}
+
+// pathInput is the merkle path of the leaf at index, or of leaf if index is nil
+func (e *Election) pathInput(leaf string, index *int) (*verifier.PathInput, error) {
+	if index == nil {
+		hash, ok := new(big.Int).SetString(leaf, 10)
+		if !ok {
+			return nil, ErrInvalidLeaf
+		}
+		i, err := e.zktree.IndexOf(hash)
+		if err != nil {
+			return nil, treeError(err)
+		}
+		index = &i
+	}
+	inp, err := verifier.NewPathInput(e.zktree, *index)
+	if err != nil {
+		return nil, treeError(err)
+	}
+	return inp, nil
+}
+
+// signal is the election id as the vote circuit outputs it
+func (e *Election) signal() *big.Int {
+	return new(big.Int).SetBytes([]byte(e.id))
+}
+
+// election looks up the election a transaction refers to
+func (app *DApplication) election(id string) (*Election, error) {
+	e, ok := app.elections[id]
+	if !ok {
+		return nil, ErrElectionNotFound.Wrap(fmt.Errorf("%q", id))
+	}
+	return e, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	dbm "github.com/tendermint/tm-db"
+)
+
+// withLevels returns data with a tree of depth and a key that declares levels,
+// 0 leaves the key without them
+func withLevels(t *testing.T, data AData, depth, levels int) AData {
+	var fields map[string]interface{}
+	err := json.Unmarshal(data.Vkey, &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if levels != 0 {
+		fields["levels"] = levels
+	}
+	data.Vkey, err = json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Depth = depth
+	return data
+}
+
+func TestElectionDepth(t *testing.T) {
+	cases := []struct {
+		name          string
+		depth, levels int
+		code          uint32
+	}{
+		{"genesis depth without levels", 0, 0, CodeTypeOK},
+		{"genesis depth with its levels", 0, defaultDepth, CodeTypeOK},
+		{"genesis depth with other levels", 0, 10, CodeTypeInvalidDepth},
+		{"own depth without levels", 10, 0, CodeTypeInvalidDepth},
+		{"own depth with its levels", 10, 10, CodeTypeOK},
+		{"own depth with other levels", 10, 12, CodeTypeInvalidDepth},
+		{"too deep", maxDepth + 1, maxDepth + 1, CodeTypeInvalidDepth},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			chain := newTestChain(t, dbm.NewMemDB(), ed25519.GenPrivKey())
+			data := withLevels(t, testElection(t), tc.depth, tc.levels)
+			res := chain.block(testBlock{t0, [][]byte{chain.adminTx("e", data)}})
+			if res[0].Code != tc.code {
+				t.Fatalf("got code %d (%s), want %d", res[0].Code, res[0].Log, tc.code)
+			}
+		})
+	}
+}
+
+// TestCheckTxTreeCapacity fills a tree of two leaves with one committed leaf
+// and one registration in the mempool, the next registration must be turned
+// away by CheckTx before its chip is even checked
+func TestCheckTxTreeCapacity(t *testing.T) {
+	chain := newTestChain(t, dbm.NewMemDB(), ed25519.GenPrivKey())
+	chain.block(testBlock{t0, [][]byte{chain.adminTx("e", withLevels(t, testElection(t), 1, 1))}})
+	_, err := chain.app.elections["e"].zktree.QuickInsert(big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.block(testBlock{t0 + 20, nil})
+
+	reg := registerTx(t, "e")
+	res := chain.app.CheckTx(abcitypes.RequestCheckTx{Tx: reg})
+	if res.Code != CodeTypeOK {
+		t.Fatalf("first registration: code %d (%s)", res.Code, res.Log)
+	}
+	var trans Trans
+	err = json.Unmarshal(reg, &trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans.Vdata.Dg15 = "00" + trans.Vdata.Dg15
+	other, err := json.Marshal(trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = chain.app.CheckTx(abcitypes.RequestCheckTx{Tx: other})
+	if res.Code != CodeTypeTreeFull {
+		t.Fatalf("second registration: got code %d (%s), want %d", res.Code, res.Log, CodeTypeTreeFull)
+	}
+
+	// the mempool is rechecked against the committed state after every block
+	chain.block(testBlock{t0 + 21, nil})
+	res = chain.app.CheckTx(abcitypes.RequestCheckTx{Tx: reg, Type: abcitypes.CheckTxType_Recheck})
+	if res.Code != CodeTypeOK {
+		t.Fatalf("recheck: code %d (%s)", res.Code, res.Log)
+	}
+}
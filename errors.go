@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"zkvoting/verifier"
+)
+
+// Codespace of every error code returned by the application
+const Codespace = "zkvoting"
+
+const (
+	CodeTypeOK                 uint32 = 0
+	CodeTypeError              uint32 = 1
+	CodeTypeEncodingError      uint32 = 2
+	CodeTypeUnknownType        uint32 = 3
+	CodeTypeNotInVotePeriod    uint32 = 4
+	CodeTypeNotInRegPeriod     uint32 = 5
+	CodeTypeCandidateNotFound  uint32 = 6
+	CodeTypeVerificationFailed uint32 = 7
+	CodeTypeAlreadyVoted       uint32 = 8
+	CodeTypeTamperedChip       uint32 = 9
+	CodeTypeCloningChip        uint32 = 10
+	CodeTypeKeyUsed            uint32 = 11
+	CodeTypeInvalidLeaf        uint32 = 12
+	CodeTypeAdminFailed        uint32 = 13
+	CodeTypeInvalidVkey        uint32 = 14
+	CodeTypeInvalidCandidates  uint32 = 15
+	CodeTypeElectionNotFound   uint32 = 16
+	CodeTypeInvalidElection    uint32 = 17
+	CodeTypeWrongPhase         uint32 = 18
+	CodeTypeRecordNotFound     uint32 = 19
+	CodeTypeUnknownRoot        uint32 = 20
+	CodeTypeWrongElection      uint32 = 21
+	CodeTypeInvalidHasher      uint32 = 22
+	CodeTypeInvalidDepth       uint32 = 23
+	CodeTypeTreeFull           uint32 = 24
+	CodeTypeLeafNotFound       uint32 = 25
+	CodeTypeHashFailed         uint32 = 26
+	CodeTypeRootNotFound       uint32 = 27
+	CodeTypeWrongProtocol      uint32 = 28
+	CodeTypeInvalidWindow      uint32 = 29
+	CodeTypeTooManyLeaves      uint32 = 30
+)
+
+// TxError is the reason a transaction was rejected
+type TxError struct {
+	Code uint32
+	Msg  string
+}
+
+func (e *TxError) Error() string {
+	return e.Msg
+}
+
+// Is matches errors by code so wrapped errors compare equal to the catalogue entry
+func (e *TxError) Is(target error) bool {
+	t, ok := target.(*TxError)
+	return ok && t.Code == e.Code
+}
+
+// Wrap adds the underlying cause to the message and keeps the code
+func (e *TxError) Wrap(err error) *TxError {
+	return &TxError{Code: e.Code, Msg: fmt.Sprintf("%s: %v", e.Msg, err)}
+}
+
+var (
+	ErrEncoding           = &TxError{CodeTypeEncodingError, "Invalid transaction encoding"}
+	ErrUnknownType        = &TxError{CodeTypeUnknownType, "Unknown transaction type"}
+	ErrNotInVotePeriod    = &TxError{CodeTypeNotInVotePeriod, "Not in the voting period"}
+	ErrNotInRegPeriod     = &TxError{CodeTypeNotInRegPeriod, "Not in the register period"}
+	ErrCandidateNotFound  = &TxError{CodeTypeCandidateNotFound, "Candidate not found"}
+	ErrVerificationFailed = &TxError{CodeTypeVerificationFailed, "Verification failed"}
+	ErrAlreadyVoted       = &TxError{CodeTypeAlreadyVoted, "This voter has already voted"}
+	ErrTamperedChip       = &TxError{CodeTypeTamperedChip, "Tampered Chip"}
+	ErrCloningChip        = &TxError{CodeTypeCloningChip, "Cloning Chip"}
+	ErrKeyUsed            = &TxError{CodeTypeKeyUsed, "This pubkey has already used"}
+	ErrInvalidLeaf        = &TxError{CodeTypeInvalidLeaf, "Invalid leaf hash"}
+	ErrAdminFailed        = &TxError{CodeTypeAdminFailed, "Admin verification failed"}
+	ErrInvalidVkey        = &TxError{CodeTypeInvalidVkey, "Invalid verification key"}
+	ErrInvalidCandidates  = &TxError{CodeTypeInvalidCandidates, "Invalid candidate list"}
+	ErrElectionNotFound   = &TxError{CodeTypeElectionNotFound, "Election not found"}
+	ErrInvalidElection    = &TxError{CodeTypeInvalidElection, "Invalid election id"}
+	ErrWrongPhase         = &TxError{CodeTypeWrongPhase, "Election is not in the right phase"}
+	ErrRecordNotFound     = &TxError{CodeTypeRecordNotFound, "Election record not found"}
+	ErrUnknownRoot        = &TxError{CodeTypeUnknownRoot, "Unknown merkle root"}
+	ErrWrongElection      = &TxError{CodeTypeWrongElection, "Proof is for another election"}
+	ErrInvalidHasher      = &TxError{CodeTypeInvalidHasher, "Unsupported tree hash"}
+	ErrInvalidDepth       = &TxError{CodeTypeInvalidDepth, "Invalid tree depth"}
+	ErrTreeFull           = &TxError{CodeTypeTreeFull, "Voter tree is full"}
+	ErrLeafNotFound       = &TxError{CodeTypeLeafNotFound, "Leaf not found in voter tree"}
+	ErrHashFailed         = &TxError{CodeTypeHashFailed, "Voter tree hash failed"}
+	ErrRootNotFound       = &TxError{CodeTypeRootNotFound, "No root recorded at this height"}
+	ErrWrongProtocol      = &TxError{CodeTypeWrongProtocol, "Proof is for another proof system"}
+	ErrInvalidWindow      = &TxError{CodeTypeInvalidWindow, "Invalid election window"}
+	ErrTooManyLeaves      = &TxError{CodeTypeTooManyLeaves, "Too many leaves, query them page by page with leaves"}
+)
+
+// treeError turns an error of the voter tree into the rejection of a transaction
+func treeError(err error) *TxError {
+	switch {
+	case errors.Is(err, verifier.ErrTreeFull):
+		return ErrTreeFull.Wrap(err)
+	case errors.Is(err, verifier.ErrIndexOutOfRange), errors.Is(err, verifier.ErrElementNotFound):
+		return ErrLeafNotFound.Wrap(err)
+	case errors.Is(err, verifier.ErrHashFailed):
+		return ErrHashFailed.Wrap(err)
+	}
+	return &TxError{CodeTypeError, err.Error()}
+}
+
+// errorCode returns the code and log for a rejected transaction
+func errorCode(err error) (uint32, string) {
+	var txErr *TxError
+	if errors.As(err, &txErr) {
+		return txErr.Code, txErr.Msg
+	}
+	return CodeTypeError, err.Error()
+}
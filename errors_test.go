@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"zkvoting/verifier"
+)
+
+func TestTreeError(t *testing.T) {
+	cases := []struct {
+		err  error
+		code uint32
+	}{
+		{fmt.Errorf("%w: 4 leaves", verifier.ErrTreeFull), CodeTypeTreeFull},
+		{fmt.Errorf("%w: 5 of 4", verifier.ErrIndexOutOfRange), CodeTypeLeafNotFound},
+		{verifier.ErrElementNotFound, CodeTypeLeafNotFound},
+		{fmt.Errorf("%w: leaf is not a field element", verifier.ErrHashFailed), CodeTypeHashFailed},
+		{errors.New("store failed"), CodeTypeError},
+	}
+	for _, tc := range cases {
+		txErr := treeError(tc.err)
+		code, log := errorCode(txErr)
+		if code != tc.code {
+			t.Errorf("%v: got code %d, want %d", tc.err, code, tc.code)
+		}
+		if !errors.Is(txErr, &TxError{Code: tc.code}) {
+			t.Errorf("%v: does not match code %d", tc.err, tc.code)
+		}
+		if log == "" {
+			t.Errorf("%v: empty log", tc.err)
+		}
+	}
+}
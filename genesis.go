@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"fmt"
+	"math/big"
+
+	"github.com/keybase/go-crypto/brainpool"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+)
+
+// depth of the voter tree when neither genesis nor the election sets one
+const defaultDepth = 20
+
+// deepest voter tree an election can use
+const maxDepth = 32
+
+// GenesisState is the app_state section of genesis.json, every validator
+// starts from the same admins, elections and trusted passport issuers
+type GenesisState struct {
+	Admins    [][]byte          `json:"admins"`
+	Elections []GenesisElection `json:"elections,omitempty"`
+	Depth     int               `json:"depth"`
+	CSCA      []CSCAKey         `json:"csca"`
+}
+
+// GenesisElection is an election set up at genesis instead of by an admin tx
+type GenesisElection struct {
+	ID string `json:"id"`
+	AData
+}
+
+// CSCAKey is a trusted country signing CA key, coordinates are decimal
+type CSCAKey struct {
+	Curve string `json:"curve"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+var cscaCurves = map[string]func() elliptic.Curve{
+	"P-256":           elliptic.P256,
+	"P-384":           elliptic.P384,
+	"P-521":           elliptic.P521,
+	"brainpoolP256r1": brainpool.P256r1,
+	"brainpoolP384r1": brainpool.P384r1,
+	"brainpoolP512r1": brainpool.P512r1,
+}
+
+// parseCSCA turns the genesis keys into ecdsa keys used by v1_verify
+func parseCSCA(keys []CSCAKey) ([]*ecdsa.PublicKey, error) {
+	pubs := make([]*ecdsa.PublicKey, 0, len(keys))
+	for _, key := range keys {
+		curve, ok := cscaCurves[key.Curve]
+		if !ok {
+			return nil, fmt.Errorf("unsupported CSCA curve %q", key.Curve)
+		}
+		x, okx := new(big.Int).SetString(key.X, 10)
+		y, oky := new(big.Int).SetString(key.Y, 10)
+		if !okx || !oky || !curve().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid CSCA key on %s", key.Curve)
+		}
+		pubs = append(pubs, &ecdsa.PublicKey{Curve: curve(), X: x, Y: y})
+	}
+	return pubs, nil
+}
+
+// validate rejects a genesis the chain could not start from
+func (genesis *GenesisState) validate() error {
+	for _, admin := range genesis.Admins {
+		if len(admin) != ed25519.PubKeySize {
+			return fmt.Errorf("invalid admin key %X", admin)
+		}
+	}
+	if genesis.Depth < 0 || genesis.Depth > maxDepth {
+		return fmt.Errorf("invalid tree depth %d", genesis.Depth)
+	}
+	_, err := parseCSCA(genesis.CSCA)
+	return err
+}
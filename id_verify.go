@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
@@ -16,7 +15,7 @@ import (
 	"github.com/keybase/go-crypto/brainpool"
 )
 
-func v1_verify(dg15, sod string) bool {
+func v1_verify(dg15, sod string, csca []*ecdsa.PublicKey) bool {
 	var verify_result = true
 	dg15_bytes, err := hex.DecodeString(dg15)
 	if err != nil {
@@ -130,16 +129,14 @@ func v1_verify(dg15, sod string) bool {
 	var verified_signeddata = ecdsa.Verify(&cert_pubkey, sign_digest[:], r, s)
 	verify_result = verify_result && verified_signeddata
 
-	ca_pub_x := new(big.Int)
-	ca_pub_y := new(big.Int)
-	ca_pub_x.SetString("5705586746797687392276527904990313555022905475611271258729414636068323857880334000957361424951661974682935706611888", 10)
-	ca_pub_y.SetString("7821704373206592378644977211567592118672246135776362491204878202396889655625917188376232816427307041739256606332695", 10)
-	var ca_pubkey = ecdsa.PublicKey{
-		Curve: elliptic.P384(),
-		X: ca_pub_x,
-		Y: ca_pub_y,
+	// document signer certificate must be signed by one of the trusted CSCA keys
+	var verified_cert = false
+	for _, ca_pubkey := range csca {
+		if ecdsa.Verify(ca_pubkey, cert_digest[:], cert_r, cert_s) {
+			verified_cert = true
+			break
+		}
 	}
-	var verified_cert = ecdsa.Verify(&ca_pubkey, cert_digest[:], cert_r, cert_s)
 	verify_result = verify_result && verified_cert
 	return verify_result
 }
@@ -197,6 +194,23 @@ func v2_verify(h, aaSig, dg15 string) bool {
 	return bytes.Equal(hash, hash_calc)
 }
 
+// verifyChip runs both passport checks, a malformed SOD or DG15 makes the
+// ASN.1 walk index out of range so panics are turned into a rejection
+func verifyChip(ver *Verify, csca []*ecdsa.PublicKey) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrTamperedChip.Wrap(fmt.Errorf("%v", r))
+		}
+	}()
+	if !v1_verify(ver.Dg15, ver.Sod, csca) {
+		return ErrTamperedChip
+	}
+	if !v2_verify(ver.H, ver.AaSig, ver.Dg15) {
+		return ErrCloningChip
+	}
+	return nil
+}
+
 func readJSONFile(filename string) ([]byte, error) {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
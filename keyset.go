@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	dbm "github.com/tendermint/tm-db"
+)
+
+// keySet is a set of strings of one election, the nullifiers of counted votes
+// or the DG15 keys of registered voters. Every member is its own key
+// "<name>/<tree id>/<member>" holding its insertion index, so a block only
+// touches the members it adds. Adds are buffered like the tree nodes until
+// Commit flushes them. The set keeps its size and a hash chained over the
+// members in insertion order, the app hash commits to those instead of
+// reading the whole set
+type keySet struct {
+	db     dbm.DB
+	prefix []byte
+	dirty  map[string]uint64
+	size   int
+	hash   []byte
+}
+
+// names of the key sets of an election
+const (
+	votedSet = "voted"
+	usedSet  = "used"
+)
+
+func keySetPrefix(name string, tree int) []byte {
+	return []byte(fmt.Sprintf("%s/%d/", name, tree))
+}
+
+// newKeySet opens the set name of tree with size members whose chained hash
+// is hash
+func newKeySet(db dbm.DB, name string, tree int, size int, hash []byte) *keySet {
+	return &keySet{
+		db:     db,
+		prefix: keySetPrefix(name, tree),
+		dirty:  make(map[string]uint64),
+		size:   size,
+		hash:   hash,
+	}
+}
+
+func (s *keySet) key(member string) []byte {
+	key := make([]byte, 0, len(s.prefix)+len(member))
+	key = append(key, s.prefix...)
+	return append(key, member...)
+}
+
+// Has reports whether member is in the set
+func (s *keySet) Has(member string) (bool, error) {
+	if _, ok := s.dirty[member]; ok {
+		return true, nil
+	}
+	return s.db.Has(s.key(member))
+}
+
+// Add puts member in the set, the caller checks it is not there yet
+func (s *keySet) Add(member string) {
+	s.dirty[member] = uint64(s.size)
+	s.size++
+	h := sha256.New()
+	h.Write(s.hash)
+	h.Write(binary.AppendUvarint(nil, uint64(len(member))))
+	h.Write([]byte(member))
+	s.hash = h.Sum(nil)
+}
+
+// flush moves the buffered members into batch
+func (s *keySet) flush(batch dbm.Batch) error {
+	for member, index := range s.dirty {
+		err := batch.Set(s.key(member), binary.BigEndian.AppendUint64(nil, index))
+		if err != nil {
+			return err
+		}
+	}
+	s.dirty = make(map[string]uint64)
+	return nil
+}
+
+// copy returns the set as seen by the check state, members it adds stay in
+// its own buffer and are never flushed
+func (s *keySet) copy() *keySet {
+	cp := *s
+	cp.dirty = make(map[string]uint64, len(s.dirty))
+	for member, index := range s.dirty {
+		cp.dirty[member] = index
+	}
+	return &cp
+}
+
+// members lists the set in insertion order, for snapshots
+func (s *keySet) members() ([]string, error) {
+	members := make([]string, s.size)
+	found := 0
+	put := func(member string, index uint64) error {
+		if index >= uint64(len(members)) || members[index] != "" {
+			return fmt.Errorf("corrupt set %s at %d", s.prefix, index)
+		}
+		members[index] = member
+		found++
+		return nil
+	}
+	it, err := dbm.IteratePrefix(s.db, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		member := string(it.Key()[len(s.prefix):])
+		if _, ok := s.dirty[member]; ok {
+			continue
+		}
+		err = put(member, binary.BigEndian.Uint64(it.Value()))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = it.Error(); err != nil {
+		return nil, err
+	}
+	for _, member := range sortedKeys(s.dirty) {
+		err = put(member, s.dirty[member])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if found != s.size {
+		return nil, fmt.Errorf("set %s has %d of %d members", s.prefix, found, s.size)
+	}
+	return members, nil
+}
@@ -7,8 +7,8 @@ import (
  "os/signal"
  "path/filepath"
  "syscall"
- "io/ioutil"
  "github.com/spf13/viper"
+ dbm "github.com/tendermint/tm-db"
 
  abci "github.com/tendermint/tendermint/abci/types"
  cfg "github.com/tendermint/tendermint/config"
@@ -21,42 +21,87 @@ import (
 )
 
 var configFile string
-var vkFile string 
-var candidateFile string
-var registerTime int64
 
 func init() {
 	flag.StringVar(&configFile, "config", "/tmp/zkvoting/config/config.toml", "Path to config.toml")
-	flag.StringVar(&vkFile,"verifykey", "verification_key.json", "The government's verification key")
+	flag.Int64Var(&snapshotInterval, "snapshot-interval", 100, "Blocks between state sync snapshots, 0 disables snapshots")
 }
 
 func main() {
-	vkey, err := ioutil.ReadFile(vkFile)
-	if err != nil {
-		fmt.Println("Error reading file:", err)
-		return
+	flag.Parse()
+
+	// subcommands, anything else starts the node
+	switch flag.Arg(0) {
+		case "admin":
+			err := runAdminSign(flag.Args()[1:])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "tree":
+			err := runTree(flag.Args()[1:])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
 	}
 
-	flag.Parse()
+	// application state lives next to tendermint's own data
+	dbDir := filepath.Join(filepath.Dir(filepath.Dir(configFile)), "data")
+	db, err := dbm.NewDB("zkvoting", dbm.GoLevelDBBackend, dbDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open app database: %v", err)
+		os.Exit(1)
+	}
 
-	app := NewDApplication(vkey)
+	app := NewDApplication(db)
 
 	node, err := newTendermint(app, configFile)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v", err)
+		db.Close()
 		os.Exit(2)
 	}
 
-	node.Start()
-	defer func() {
-		node.Stop()
-		node.Wait()
-	}()
+	// tendermint saves a block to its store before the app runs it, so
+	// BeginBlock can verify the votes of the block in one batch
+	blocks := node.BlockStore()
+	app.blockTxs = func(height int64) [][]byte {
+		block := blocks.LoadBlock(height)
+		if block == nil {
+			return nil
+		}
+		txs := make([][]byte, len(block.Txs))
+		for i, tx := range block.Txs {
+			txs[i] = tx
+		}
+		return txs
+	}
+
+	err = node.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start node: %v", err)
+		db.Close()
+		os.Exit(2)
+	}
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
-	os.Exit(0)
+
+	// stop the node first so no block is committed to a closed database
+	err = node.Stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to stop node: %v", err)
+	}
+	node.Wait()
+	err = db.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to close app database: %v", err)
+		os.Exit(1)
+	}
 }
 
 func newTendermint(app abci.Application, configFile string) (*nm.Node, error) {
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	dbm "github.com/tendermint/tm-db"
+)
+
+const (
+	snapshotFormat     uint32 = 1
+	snapshotChunkSize         = 1 << 20 // bytes per chunk
+	snapshotKeepRecent        = 2       // snapshots kept on disk
+)
+
+var (
+	// snapshotInterval is the number of blocks between snapshots, 0 disables them
+	snapshotInterval int64 = 100
+
+	snapshotMetaPrefix  = []byte("snapshot/meta/")
+	snapshotChunkPrefix = []byte("snapshot/chunk/")
+)
+
+// snapshotMeta is stored in Snapshot.Metadata so every chunk can be checked on arrival
+type snapshotMeta struct {
+	ChunkHashes [][]byte `json:"chunkhashes"`
+}
+
+// snapshotRestore tracks a snapshot being applied during state sync
+type snapshotRestore struct {
+	snapshot *abcitypes.Snapshot
+	appHash  []byte
+	meta     snapshotMeta
+	chunks   [][]byte
+	received int
+}
+
+func heightKey(prefix []byte, height uint64) []byte {
+	key := append([]byte{}, prefix...)
+	return binary.BigEndian.AppendUint64(key, height)
+}
+
+func chunkKey(height uint64, index uint32) []byte {
+	key := heightKey(snapshotChunkPrefix, height)
+	return binary.BigEndian.AppendUint32(key, index)
+}
+
+// takeSnapshot stores the committed state in chunks and prunes old snapshots
+func (app *DApplication) takeSnapshot(state *State) error {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	height := uint64(state.Height)
+	batch := app.db.NewBatch()
+	defer batch.Close()
+
+	var meta snapshotMeta
+	for index := 0; index*snapshotChunkSize < len(payload); index++ {
+		end := (index + 1) * snapshotChunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunk := payload[index*snapshotChunkSize : end]
+		hash := sha256.Sum256(chunk)
+		meta.ChunkHashes = append(meta.ChunkHashes, hash[:])
+		err = batch.Set(chunkKey(height, uint32(index)), chunk)
+		if err != nil {
+			return err
+		}
+	}
+	metadata, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(payload)
+	snapshot := abcitypes.Snapshot{
+		Height:   height,
+		Format:   snapshotFormat,
+		Chunks:   uint32(len(meta.ChunkHashes)),
+		Hash:     hash[:],
+		Metadata: metadata,
+	}
+	bz, err := snapshot.Marshal()
+	if err != nil {
+		return err
+	}
+	err = batch.Set(heightKey(snapshotMetaPrefix, height), bz)
+	if err != nil {
+		return err
+	}
+
+	// drop everything but the most recent snapshots
+	snapshots, err := app.snapshots()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(snapshots)+1-snapshotKeepRecent; i++ {
+		old := snapshots[i]
+		err = batch.Delete(heightKey(snapshotMetaPrefix, old.Height))
+		if err != nil {
+			return err
+		}
+		for index := uint32(0); index < old.Chunks; index++ {
+			err = batch.Delete(chunkKey(old.Height, index))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return batch.WriteSync()
+}
+
+// snapshots lists the stored snapshots, oldest first
+func (app *DApplication) snapshots() ([]*abcitypes.Snapshot, error) {
+	it, err := dbm.NewPrefixDB(app.db, snapshotMetaPrefix).Iterator(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var snapshots []*abcitypes.Snapshot
+	for ; it.Valid(); it.Next() {
+		var snapshot abcitypes.Snapshot
+		err = snapshot.Unmarshal(it.Value())
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+	return snapshots, it.Error()
+}
+
+func (app *DApplication) ListSnapshots(abcitypes.RequestListSnapshots) abcitypes.ResponseListSnapshots {
+	snapshots, err := app.snapshots()
+	if err != nil {
+		panic(err)
+	}
+	return abcitypes.ResponseListSnapshots{Snapshots: snapshots}
+}
+
+func (app *DApplication) LoadSnapshotChunk(req abcitypes.RequestLoadSnapshotChunk) abcitypes.ResponseLoadSnapshotChunk {
+	if req.Format != snapshotFormat {
+		return abcitypes.ResponseLoadSnapshotChunk{}
+	}
+	chunk, err := app.db.Get(chunkKey(req.Height, req.Chunk))
+	if err != nil {
+		panic(err)
+	}
+	return abcitypes.ResponseLoadSnapshotChunk{Chunk: chunk}
+}
+
+func (app *DApplication) OfferSnapshot(req abcitypes.RequestOfferSnapshot) abcitypes.ResponseOfferSnapshot {
+	snapshot := req.Snapshot
+	if snapshot == nil {
+		return abcitypes.ResponseOfferSnapshot{Result: abcitypes.ResponseOfferSnapshot_REJECT}
+	}
+	if snapshot.Format != snapshotFormat {
+		return abcitypes.ResponseOfferSnapshot{Result: abcitypes.ResponseOfferSnapshot_REJECT_FORMAT}
+	}
+	var meta snapshotMeta
+	err := json.Unmarshal(snapshot.Metadata, &meta)
+	if err != nil || snapshot.Chunks == 0 || len(meta.ChunkHashes) != int(snapshot.Chunks) {
+		return abcitypes.ResponseOfferSnapshot{Result: abcitypes.ResponseOfferSnapshot_REJECT}
+	}
+
+	// req.AppHash comes from the light client and is what the restored state must hash to
+	app.restoring = &snapshotRestore{
+		snapshot: snapshot,
+		appHash:  req.AppHash,
+		meta:     meta,
+		chunks:   make([][]byte, snapshot.Chunks),
+	}
+	return abcitypes.ResponseOfferSnapshot{Result: abcitypes.ResponseOfferSnapshot_ACCEPT}
+}
+
+func (app *DApplication) ApplySnapshotChunk(req abcitypes.RequestApplySnapshotChunk) abcitypes.ResponseApplySnapshotChunk {
+	r := app.restoring
+	if r == nil || req.Index >= uint32(len(r.chunks)) {
+		return abcitypes.ResponseApplySnapshotChunk{Result: abcitypes.ResponseApplySnapshotChunk_ABORT}
+	}
+
+	// a chunk that does not match the metadata is fetched again from another peer
+	hash := sha256.Sum256(req.Chunk)
+	if !bytes.Equal(hash[:], r.meta.ChunkHashes[req.Index]) {
+		return abcitypes.ResponseApplySnapshotChunk{
+			Result:        abcitypes.ResponseApplySnapshotChunk_RETRY,
+			RefetchChunks: []uint32{req.Index},
+			RejectSenders: []string{req.Sender},
+		}
+	}
+	if r.chunks[req.Index] == nil {
+		r.received++
+	}
+	r.chunks[req.Index] = req.Chunk
+	if r.received < len(r.chunks) {
+		return abcitypes.ResponseApplySnapshotChunk{Result: abcitypes.ResponseApplySnapshotChunk_ACCEPT}
+	}
+
+	// all chunks are in, rebuild the state and check it against the trusted app hash
+	app.restoring = nil
+	payload := bytes.Join(r.chunks, nil)
+	hash = sha256.Sum256(payload)
+	if !bytes.Equal(hash[:], r.snapshot.Hash) {
+		return abcitypes.ResponseApplySnapshotChunk{Result: abcitypes.ResponseApplySnapshotChunk_REJECT_SNAPSHOT}
+	}
+	var state State
+	err := json.Unmarshal(payload, &state)
+	if err != nil || state.Height != int64(r.snapshot.Height) {
+		return abcitypes.ResponseApplySnapshotChunk{Result: abcitypes.ResponseApplySnapshotChunk_REJECT_SNAPSHOT}
+	}
+	restored := &DApplication{db: app.db}
+	err = restored.restore(&state, true)
+	if err != nil || !bytes.Equal(restored.hash(), r.appHash) {
+		return abcitypes.ResponseApplySnapshotChunk{Result: abcitypes.ResponseApplySnapshotChunk_REJECT_SNAPSHOT}
+	}
+
+	*app = *restored
+	err = app.persist()
+	if err != nil {
+		panic(err)
+	}
+	app.checkState = app.copyState()
+	return abcitypes.ResponseApplySnapshotChunk{Result: abcitypes.ResponseApplySnapshotChunk_ACCEPT}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	dbm "github.com/tendermint/tm-db"
+)
+
+// applyState offers state to a new node as a one chunk snapshot trusted to
+// hash to appHash and returns the new node and the result of the last chunk
+func applyState(t *testing.T, state *State, appHash []byte) (*DApplication, abcitypes.ResponseApplySnapshotChunk_Result) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(payload)
+	metadata, err := json.Marshal(snapshotMeta{ChunkHashes: [][]byte{hash[:]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := NewDApplication(dbm.NewMemDB())
+	offer := app.OfferSnapshot(abcitypes.RequestOfferSnapshot{
+		Snapshot: &abcitypes.Snapshot{
+			Height:   uint64(state.Height),
+			Format:   snapshotFormat,
+			Chunks:   1,
+			Hash:     hash[:],
+			Metadata: metadata,
+		},
+		AppHash: appHash,
+	})
+	if offer.Result != abcitypes.ResponseOfferSnapshot_ACCEPT {
+		t.Fatalf("snapshot offer: %v", offer.Result)
+	}
+	res := app.ApplySnapshotChunk(abcitypes.RequestApplySnapshotChunk{Index: 0, Chunk: payload})
+	return app, res.Result
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	chain := newTestChain(t, dbm.NewMemDB(), ed25519.GenPrivKey())
+	chain.block(testBlock{t0, [][]byte{
+		chain.adminTx("e", testElection(t)),
+		chain.adminTx("f", testElection(t)),
+	}})
+	chain.block(testBlock{t0 + 20, [][]byte{registerTx(t, "e")}})
+	appHash := chain.app.appHash
+
+	snapshot := func() *State {
+		state, err := chain.app.snapshotState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state
+	}
+
+	restored, result := applyState(t, snapshot(), appHash)
+	if result != abcitypes.ResponseApplySnapshotChunk_ACCEPT {
+		t.Fatalf("untouched snapshot: %v", result)
+	}
+	if restored.elections["e"].zktree.Size() != 1 || restored.elections["e"].used.size != 1 {
+		t.Fatal("restored election lost its voter")
+	}
+	if string(NewDApplication(restored.db).hash()) != string(appHash) {
+		t.Fatal("restarted node does not match the snapshot")
+	}
+
+	tampered := []struct {
+		name string
+		edit func(*State)
+	}{
+		{"planted root", func(s *State) { s.Elections[0].Roots[5] = "12345" }},
+		{"shared tree", func(s *State) { s.Elections[1].Tree = s.Elections[0].Tree }},
+		{"dropped leaves", func(s *State) { s.Elections[0].Leaves = nil }},
+		{"dropped key", func(s *State) { s.Elections[0].IsUsed = nil }},
+	}
+	for _, tc := range tampered {
+		t.Run(tc.name, func(t *testing.T) {
+			state := snapshot()
+			tc.edit(state)
+			_, result := applyState(t, state, appHash)
+			if result != abcitypes.ResponseApplySnapshotChunk_REJECT_SNAPSHOT {
+				t.Fatalf("got %v, want REJECT_SNAPSHOT", result)
+			}
+		})
+	}
+}
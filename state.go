@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	dbm "github.com/tendermint/tm-db"
+	"zkvoting/verifier"
+)
+
+var (
+	stateKey = []byte("stateKey")
+)
+
+// State is the application state written to the database at every Commit
+type State struct {
+	Height     int64            `json:"height"`
+	AppHash    []byte           `json:"apphash"`
+	Elections  []ElectionState  `json:"elections"`
+	Archive    []ElectionRecord `json:"archive"`
+	VoteID     int              `json:"voteid"`
+	Admins     [][]byte         `json:"admins"`
+	AdminNonce uint64           `json:"adminnonce"`
+	ChainID    string           `json:"chainid"`
+	Depth      int              `json:"depth"`
+	CSCA       []CSCAKey        `json:"csca"`
+}
+
+// ElectionState is the saved state of one election. The voter tree and the
+// key sets are stored key by key under its tree id, only snapshots carry the
+// leaves, nullifiers and used keys
+type ElectionState struct {
+	ID        string           `json:"id"`
+	Phase     Phase            `json:"phase"`
+	Tree      int              `json:"tree"`
+	Hasher    string           `json:"hasher,omitempty"`
+	Depth     int              `json:"depth"`
+	Size      int              `json:"size"`
+	Roots     []string         `json:"roots"`
+	RootIndex int              `json:"rootindex"`
+	Leaves    []string         `json:"leaves,omitempty"`
+	Candidate map[string]int64 `json:"candidate"`
+	Voted     int              `json:"voted"`
+	VotedHash []byte           `json:"votedhash"`
+	Used      int              `json:"used"`
+	UsedHash  []byte           `json:"usedhash"`
+	IsVoted   []string         `json:"isvoted,omitempty"`
+	IsUsed    []string         `json:"isused,omitempty"`
+	VoterID   int              `json:"voterid"`
+	Vkey      json.RawMessage  `json:"vkey"`
+	RegStart  int64            `json:"regstart"`
+	RegEnd    int64            `json:"regend"`
+	VoteStart int64            `json:"votestart"`
+	VoteEnd   int64            `json:"voteend"`
+}
+
+// loadState reads the last committed state, returns nil if the database is empty
+func loadState(db dbm.DB) (*State, error) {
+	bz, err := db.Get(stateKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(bz) == 0 {
+		return nil, nil
+	}
+	var state State
+	err = json.Unmarshal(bz, &state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// persist writes the state and the buffered tree nodes in one synchronous
+// batch so a crash right after Commit never leaves them out of step
+func (app *DApplication) persist() error {
+	batch := app.db.NewBatch()
+	defer batch.Close()
+	for _, id := range sortedKeys(app.elections) {
+		e := app.elections[id]
+		err := e.store.flush(batch)
+		if err != nil {
+			return err
+		}
+		err = e.voted.flush(batch)
+		if err != nil {
+			return err
+		}
+		err = e.used.flush(batch)
+		if err != nil {
+			return err
+		}
+		err = recordRoot(app.db, batch, e.tree, app.height, e.zktree.GetRoot())
+		if err != nil {
+			return err
+		}
+	}
+	for _, tree := range app.dropped {
+		err := dropTree(app.db, batch, tree)
+		if err != nil {
+			return err
+		}
+	}
+	bz, err := json.Marshal(app.state())
+	if err != nil {
+		return err
+	}
+	err = batch.Set(stateKey, bz)
+	if err != nil {
+		return err
+	}
+	err = batch.WriteSync()
+	if err != nil {
+		return err
+	}
+	app.dropped = nil
+	return nil
+}
+
+// state captures the current state of the application, elections are sorted by id
+func (app *DApplication) state() *State {
+	state := &State{
+		Height:     app.height,
+		AppHash:    app.appHash,
+		Elections:  make([]ElectionState, 0, len(app.elections)),
+		Archive:    app.archive,
+		VoteID:     app.voteid,
+		Admins:     app.admins,
+		AdminNonce: app.adminNonce,
+		ChainID:    app.chainID,
+		Depth:      app.depth,
+		CSCA:       app.cscaKeys,
+	}
+	for _, id := range sortedKeys(app.elections) {
+		state.Elections = append(state.Elections, app.elections[id].state())
+	}
+	return state
+}
+
+// snapshotState is the state with the leaves of every voter tree and the
+// members of every key set, a node restoring from it rebuilds them
+func (app *DApplication) snapshotState() (*State, error) {
+	state := app.state()
+	for i := range state.Elections {
+		es := &state.Elections[i]
+		e := app.elections[es.ID]
+		var err error
+		es.Leaves, err = e.leaves(0, e.zktree.Size())
+		if err != nil {
+			return nil, err
+		}
+		es.IsVoted, err = e.voted.members()
+		if err != nil {
+			return nil, err
+		}
+		es.IsUsed, err = e.used.members()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+func (e *Election) state() ElectionState {
+	roots, current := e.zktree.History()
+	es := ElectionState{
+		ID:        e.id,
+		Phase:     e.phase,
+		Tree:      e.tree,
+		Hasher:    e.hasher,
+		Depth:     e.depth,
+		Size:      e.zktree.Size(),
+		Roots:     make([]string, len(roots)),
+		RootIndex: current,
+		Candidate: e.candidate,
+		Voted:     e.voted.size,
+		VotedHash: e.voted.hash,
+		Used:      e.used.size,
+		UsedHash:  e.used.hash,
+		VoterID:   e.voterid,
+		Vkey:      e.vkeyJSON,
+		RegStart:  e.regStart,
+		RegEnd:    e.regEnd,
+		VoteStart: e.voteStart,
+		VoteEnd:   e.voteEnd,
+	}
+	for i, root := range roots {
+		if root != nil {
+			es.Roots[i] = root.String()
+		}
+	}
+	return es
+}
+
+// restore rebuilds the application from a saved state, or from a snapshot
+// that carries the content of the voter trees and key sets
+func (app *DApplication) restore(state *State, snapshot bool) error {
+	app.elections = make(map[string]*Election, len(state.Elections))
+	trees := make(map[int]bool, len(state.Elections))
+	for _, es := range state.Elections {
+		if _, ok := app.elections[es.ID]; ok || trees[es.Tree] {
+			return fmt.Errorf("election %q: duplicate election or tree %d", es.ID, es.Tree)
+		}
+		e, err := restoreElection(app.db, es, snapshot)
+		if err != nil {
+			return fmt.Errorf("election %q: %w", es.ID, err)
+		}
+		app.elections[e.id] = e
+		trees[es.Tree] = true
+	}
+	app.archive = state.Archive
+	app.voteid = state.VoteID
+	app.admins = state.Admins
+	app.adminNonce = state.AdminNonce
+	app.chainID = state.ChainID
+	app.depth = state.Depth
+	app.cscaKeys = state.CSCA
+	var err error
+	app.csca, err = parseCSCA(state.CSCA)
+	if err != nil {
+		return err
+	}
+	app.height = state.Height
+	app.appHash = state.AppHash
+	return nil
+}
+
+// restoreElection opens the voter tree and key sets of an election, from the
+// database or by inserting the leaves and members again when restoring a
+// snapshot
+func restoreElection(db dbm.DB, es ElectionState, snapshot bool) (*Election, error) {
+	depth := es.Depth
+	if depth < 1 || depth > maxDepth {
+		return nil, fmt.Errorf("invalid tree depth %d", depth)
+	}
+	roots := make([]*big.Int, len(es.Roots))
+	for i, root := range es.Roots {
+		if root == "" {
+			continue
+		}
+		num, ok := new(big.Int).SetString(root, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid root %s", root)
+		}
+		roots[i] = num
+	}
+	hasher, err := verifier.NewHasher(es.Hasher)
+	if err != nil {
+		return nil, err
+	}
+	store := newTreeStore(db, es.Tree)
+	// a snapshot must carry every leaf, nothing of its trees is in the database yet
+	if snapshot {
+		rebuilt, err := verifier.NewZkTreeWithStore(depth, store, hasher)
+		if err != nil {
+			return nil, err
+		}
+		for _, leaf := range es.Leaves {
+			hash, ok := new(big.Int).SetString(leaf, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid leaf %s", leaf)
+			}
+			_, err := rebuilt.QuickInsert(hash)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if es.Size != len(es.Leaves) || es.RootIndex < 0 || es.RootIndex >= len(roots) ||
+			roots[es.RootIndex] == nil || roots[es.RootIndex].Cmp(rebuilt.GetRoot()) != 0 {
+			return nil, fmt.Errorf("leaves do not match the root")
+		}
+	}
+	zktree, err := verifier.LoadZkTree(depth, store, hasher, es.Size, roots, es.RootIndex)
+	if err != nil {
+		return nil, err
+	}
+	voted := newKeySet(db, votedSet, es.Tree, es.Voted, es.VotedHash)
+	used := newKeySet(db, usedSet, es.Tree, es.Used, es.UsedHash)
+	if snapshot {
+		voted, err = rebuildKeySet(db, votedSet, es.Tree, es.IsVoted, es.Voted, es.VotedHash)
+		if err != nil {
+			return nil, err
+		}
+		used, err = rebuildKeySet(db, usedSet, es.Tree, es.IsUsed, es.Used, es.UsedHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	verifyKey, err := verifier.ParseVerifyingKey(es.Vkey)
+	if err != nil {
+		return nil, err
+	}
+	signals, err := verifier.SignalLayout(verifyKey.SignalNames(), verifyKey.PublicInputs())
+	if err != nil {
+		return nil, err
+	}
+	return &Election{
+		id:        es.ID,
+		phase:     es.Phase,
+		zktree:    zktree,
+		tree:      es.Tree,
+		hasher:    es.Hasher,
+		depth:     es.Depth,
+		store:     store,
+		candidate: es.Candidate,
+		voted:     voted,
+		used:      used,
+		voterid:   es.VoterID,
+		verifyKey: verifyKey,
+		signals:   signals,
+		vkeyJSON:  es.Vkey,
+		regStart:  es.RegStart,
+		regEnd:    es.RegEnd,
+		voteStart: es.VoteStart,
+		voteEnd:   es.VoteEnd,
+	}, nil
+}
+
+// rebuildKeySet adds the members of a snapshot to an empty set, their count
+// and chained hash must match the saved ones
+func rebuildKeySet(db dbm.DB, name string, tree int, members []string, size int, hash []byte) (*keySet, error) {
+	set := newKeySet(db, name, tree, 0, nil)
+	for _, member := range members {
+		has, err := set.Has(member)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			return nil, fmt.Errorf("duplicate %s %s", name, member)
+		}
+		set.Add(member)
+	}
+	if set.size != size || !bytes.Equal(set.hash, hash) {
+		return nil, fmt.Errorf("%s set does not match its hash", name)
+	}
+	return set, nil
+}
@@ -0,0 +1,36 @@
+#!/bin/sh
+# Exports a groth16 sample from snarkjs into test/groth16/snarkjs, the files
+# next to this script are made in Go from known scalars and only show that
+# the pairing equation is checked. Needs circom 2 and snarkjs on the path
+set -e
+cd "$(dirname "$0")"
+out=snarkjs
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+cat > "$tmp/multiplier.circom" <<'EOF'
+pragma circom 2.0.0;
+
+template Multiplier() {
+    signal input a;
+    signal input b;
+    signal output c;
+    c <== a * b;
+}
+
+component main = Multiplier();
+EOF
+circom "$tmp/multiplier.circom" --r1cs --wasm -o "$tmp"
+
+snarkjs powersoftau new bn128 8 "$tmp/pot0.ptau"
+snarkjs powersoftau contribute "$tmp/pot0.ptau" "$tmp/pot1.ptau" --name=zkvoting -e="$(date +%s%N)"
+snarkjs powersoftau prepare phase2 "$tmp/pot1.ptau" "$tmp/pot.ptau"
+snarkjs groth16 setup "$tmp/multiplier.r1cs" "$tmp/pot.ptau" "$tmp/key0.zkey"
+snarkjs zkey contribute "$tmp/key0.zkey" "$tmp/key.zkey" --name=zkvoting -e="$(date +%s%N)"
+
+mkdir -p "$out"
+snarkjs zkey export verificationkey "$tmp/key.zkey" "$out/verification_key.json"
+echo '{"a": "3", "b": "11"}' > "$tmp/input.json"
+snarkjs wtns calculate "$tmp/multiplier_js/multiplier.wasm" "$tmp/input.json" "$tmp/witness.wtns"
+snarkjs groth16 prove "$tmp/key.zkey" "$tmp/witness.wtns" "$out/proof.json" "$out/public.json"
+snarkjs groth16 verify "$out/verification_key.json" "$out/public.json" "$out/proof.json"
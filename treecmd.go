@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	rpchttp "github.com/tendermint/tendermint/rpc/client/http"
+	"zkvoting/verifier"
+)
+
+// TreeExport is every leaf of a voter tree at one height, written by
+// "zkvoting tree export" and checked by "zkvoting tree verify"
+type TreeExport struct {
+	Election string   `json:"election"`
+	Height   int64    `json:"height"`
+	Depth    int      `json:"depth"`
+	Hasher   string   `json:"hasher"`
+	Root     string   `json:"root"`
+	Leaves   []string `json:"leaves"`
+}
+
+func runTree(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "export":
+			return runTreeExport(args[1:])
+		case "verify":
+			return runTreeVerify(args[1:])
+		}
+	}
+	return fmt.Errorf("usage: zkvoting tree export|verify [flags]")
+}
+
+// runTreeExport reads the leaves of an election page by page from a node
+func runTreeExport(args []string) error {
+	fs := flag.NewFlagSet("tree export", flag.ExitOnError)
+	node := fs.String("node", "http://localhost:26657", "RPC address of a node")
+	election := fs.String("election", "", "Election id")
+	out := fs.String("out", "", "Output file, stdout if empty")
+	fs.Parse(args)
+	if *election == "" {
+		return fmt.Errorf("usage: zkvoting tree export -node <rpc> -election <id> [-out <file>]")
+	}
+	client, err := rpchttp.New(*node, "/websocket")
+	if err != nil {
+		return err
+	}
+
+	// the first page fixes the height and size of the export. Registrations
+	// only append, so later pages still hold the same first leaves unless a
+	// voter was revoked meanwhile, which verify reports as a root mismatch
+	var export *TreeExport
+	size := 0
+	for export == nil || len(export.Leaves) < size {
+		start := 0
+		if export != nil {
+			start = len(export.Leaves)
+		}
+		page, err := queryLeaves(client, *election, start)
+		if err != nil {
+			return err
+		}
+		if export == nil {
+			export = &TreeExport{
+				Election: page.Election,
+				Height:   page.Height,
+				Depth:    page.Depth,
+				Hasher:   page.Hasher,
+				Root:     page.Root,
+				Leaves:   make([]string, 0, page.Size),
+			}
+			size = page.Size
+		}
+		if len(page.Leaves) == 0 && len(export.Leaves) < size {
+			return fmt.Errorf("node returned no leaves from %d", start)
+		}
+		export.Leaves = append(export.Leaves, page.Leaves...)
+	}
+	export.Leaves = export.Leaves[:size]
+
+	bz, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Fprintln(os.Stdout, string(bz))
+		return nil
+	}
+	return ioutil.WriteFile(*out, bz, 0644)
+}
+
+func queryLeaves(client *rpchttp.HTTP, election string, start int) (*LeafPage, error) {
+	data, err := json.Marshal(map[string]int{"start": start, "limit": maxLeafPage})
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.ABCIQuery(context.Background(), election+"/leaves", data)
+	if err != nil {
+		return nil, err
+	}
+	if res.Response.Code != CodeTypeOK {
+		return nil, fmt.Errorf("query failed: %s", res.Response.Log)
+	}
+	var page LeafPage
+	err = json.Unmarshal(res.Response.Value, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// runTreeVerify rebuilds the tree of an export and checks its root against
+// the export and, unless -node is empty, the root the chain committed
+func runTreeVerify(args []string) error {
+	fs := flag.NewFlagSet("tree verify", flag.ExitOnError)
+	node := fs.String("node", "http://localhost:26657", "RPC address of a node, empty to only check the export")
+	height := fs.Int64("height", 0, "Height of the committed root, the export height if 0")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: zkvoting tree verify [-node <rpc>] [-height <h>] <export.json>")
+	}
+
+	bz, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var export TreeExport
+	err = json.Unmarshal(bz, &export)
+	if err != nil {
+		return err
+	}
+	root, err := export.rebuild()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "rebuilt %d leaves, root %s\n", len(export.Leaves), root)
+	if export.Root != "" && export.Root != root.String() {
+		return fmt.Errorf("root does not match the export root %s", export.Root)
+	}
+	if *node == "" {
+		return nil
+	}
+
+	if *height == 0 {
+		*height = export.Height
+	}
+	client, err := rpchttp.New(*node, "/websocket")
+	if err != nil {
+		return err
+	}
+	res, err := client.ABCIQueryWithOptions(context.Background(), export.Election+"/root", nil,
+		rpcclient.ABCIQueryOptions{Height: *height})
+	if err != nil {
+		return err
+	}
+	if res.Response.Code != CodeTypeOK {
+		return fmt.Errorf("query failed: %s", res.Response.Log)
+	}
+	committed, ok := new(big.Int).SetString(string(res.Response.Value), 16)
+	if !ok {
+		return fmt.Errorf("invalid root %q", res.Response.Value)
+	}
+	if committed.Cmp(root) != 0 {
+		return fmt.Errorf("root does not match the root %s committed at height %d", committed, *height)
+	}
+	fmt.Fprintf(os.Stdout, "root matches the root committed at height %d\n", *height)
+	return nil
+}
+
+// rebuild inserts the leaves of the export into an empty tree and returns its root
+func (export *TreeExport) rebuild() (*big.Int, error) {
+	hasher, err := verifier.NewHasher(export.Hasher)
+	if err != nil {
+		return nil, err
+	}
+	if export.Depth < 1 || export.Depth > maxDepth {
+		return nil, fmt.Errorf("invalid tree depth %d", export.Depth)
+	}
+	leaves := make([]*big.Int, len(export.Leaves))
+	for i, leaf := range export.Leaves {
+		num, ok := new(big.Int).SetString(leaf, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid leaf %d: %q", i, leaf)
+		}
+		leaves[i] = num
+	}
+	tree, err := verifier.NewZkTreeWithStore(export.Depth, verifier.MemStore{}, hasher)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tree.BatchInsert(leaves)
+	if err != nil {
+		return nil, err
+	}
+	return tree.GetRoot(), nil
+}
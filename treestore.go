@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	dbm "github.com/tendermint/tm-db"
+)
+
+// treeStore keeps the nodes of one voter tree in the database under
+// "tree/<tree id>/". Writes are buffered until Commit flushes them in the same
+// batch as the state, so the tree on disk always matches the saved state.
+// Every leaf also gets a key from its value to its index so a path query by
+// leaf is one read instead of a scan of the tree
+type treeStore struct {
+	db     dbm.DB
+	prefix []byte
+	dirty  map[string]*big.Int
+}
+
+func treePrefix(tree int) []byte {
+	return []byte(fmt.Sprintf("tree/%d/", tree))
+}
+
+func newTreeStore(db dbm.DB, tree int) *treeStore {
+	return &treeStore{
+		db:     db,
+		prefix: treePrefix(tree),
+		dirty:  make(map[string]*big.Int),
+	}
+}
+
+func (s *treeStore) key(level, index int) []byte {
+	key := make([]byte, 0, len(s.prefix)+9)
+	key = append(key, s.prefix...)
+	key = append(key, byte(level))
+	return binary.BigEndian.AppendUint64(key, uint64(index))
+}
+
+// leafIndexTag follows the prefix of a leaf index key, it is above every level
+const leafIndexTag = 0xff
+
+func (s *treeStore) leafKey(leaf *big.Int) []byte {
+	key := make([]byte, 0, len(s.prefix)+33)
+	key = append(key, s.prefix...)
+	key = append(key, leafIndexTag)
+	return append(key, leaf.FillBytes(make([]byte, 32))...)
+}
+
+// get reads a buffered or stored value
+func (s *treeStore) get(key []byte) (*big.Int, error) {
+	if value, ok := s.dirty[string(key)]; ok {
+		return value, nil
+	}
+	bz, err := s.db.Get(key)
+	if err != nil || bz == nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bz), nil
+}
+
+func (s *treeStore) Get(level, index int) (*big.Int, error) {
+	return s.get(s.key(level, index))
+}
+
+func (s *treeStore) Set(level, index int, node *big.Int) error {
+	s.dirty[string(s.key(level, index))] = node
+	if level == 0 {
+		s.dirty[string(s.leafKey(node))] = big.NewInt(int64(index))
+	}
+	return nil
+}
+
+// LeafIndex returns the index leaf was last set at
+func (s *treeStore) LeafIndex(leaf *big.Int) (int, bool, error) {
+	if leaf.Sign() < 0 || leaf.BitLen() > 256 {
+		return 0, false, nil
+	}
+	index, err := s.get(s.leafKey(leaf))
+	if err != nil || index == nil {
+		return 0, false, err
+	}
+	return int(index.Int64()), true, nil
+}
+
+// flush moves the buffered nodes and leaf indices into batch
+func (s *treeStore) flush(batch dbm.Batch) error {
+	for key, node := range s.dirty {
+		err := batch.Set([]byte(key), node.FillBytes(make([]byte, 32)))
+		if err != nil {
+			return err
+		}
+	}
+	s.dirty = make(map[string]*big.Int)
+	return nil
+}
+
+// dropTree deletes every node, leaf index, recorded root and key set of a
+// tree that is no longer used
+func dropTree(db dbm.DB, batch dbm.Batch, tree int) error {
+	prefixes := [][]byte{treePrefix(tree), rootPrefix(tree), keySetPrefix(votedSet, tree), keySetPrefix(usedSet, tree)}
+	for _, prefix := range prefixes {
+		it, err := dbm.IteratePrefix(db, prefix)
+		if err != nil {
+			return err
+		}
+		for ; it.Valid(); it.Next() {
+			err = batch.Delete(it.Key())
+			if err != nil {
+				it.Close()
+				return err
+			}
+		}
+		err = it.Error()
+		it.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Roots of a tree are recorded under "root/<tree id>/<height>" at every
+// height the root changed, so the root committed at any height can be read
+// back. A node restored from a snapshot only has the roots after its snapshot
+func rootPrefix(tree int) []byte {
+	return []byte(fmt.Sprintf("root/%d/", tree))
+}
+
+func rootKey(tree int, height int64) []byte {
+	return binary.BigEndian.AppendUint64(rootPrefix(tree), uint64(height))
+}
+
+// rootAt returns the root of tree committed at height, nil if none was
+// recorded at or before it
+func rootAt(db dbm.DB, tree int, height int64) (*big.Int, error) {
+	it, err := db.ReverseIterator(rootPrefix(tree), rootKey(tree, height+1))
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	if !it.Valid() {
+		return nil, it.Error()
+	}
+	return new(big.Int).SetBytes(it.Value()), nil
+}
+
+// recordRoot adds root to batch at height if it differs from the last
+// recorded root of tree
+func recordRoot(db dbm.DB, batch dbm.Batch, tree int, height int64, root *big.Int) error {
+	last, err := rootAt(db, tree, height)
+	if err != nil {
+		return err
+	}
+	if last != nil && last.Cmp(root) == 0 {
+		return nil
+	}
+	return batch.Set(rootKey(tree, height), root.FillBytes(make([]byte, 32)))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	dbm "github.com/tendermint/tm-db"
+	"zkvoting/verifier"
+)
+
+// countingDB counts the reads of the database under it
+type countingDB struct {
+	dbm.DB
+	gets int
+}
+
+func (db *countingDB) Get(key []byte) ([]byte, error) {
+	db.gets++
+	return db.DB.Get(key)
+}
+
+func TestTreeStoreIndexOf(t *testing.T) {
+	db := &countingDB{DB: dbm.NewMemDB()}
+	store := newTreeStore(db, 1)
+	tree, err := verifier.NewZkTreeWithStore(10, store, verifier.Poseidon{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaves := make([]*big.Int, 200)
+	for i := range leaves {
+		leaves[i] = big.NewInt(int64(1000 + i))
+	}
+	// half the leaves are committed, the others still buffered
+	_, err = tree.BatchInsert(leaves[:100])
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := db.NewBatch()
+	err = store.flush(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = batch.WriteSync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch.Close()
+	for _, leaf := range leaves[100:] {
+		_, err = tree.QuickInsert(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, leaf := range leaves {
+		db.gets = 0
+		index, err := tree.IndexOf(leaf)
+		if err != nil {
+			t.Fatalf("leaf %d: %v", i, err)
+		}
+		if index != i {
+			t.Fatalf("leaf %d found at %d", i, index)
+		}
+		if db.gets > 2 {
+			t.Fatalf("leaf %d took %d reads", i, db.gets)
+		}
+	}
+
+	err = tree.Revoke(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaf := range []*big.Int{big.NewInt(1), leaves[7], new(big.Int).Neg(leaves[0])} {
+		_, err = tree.IndexOf(leaf)
+		if !errors.Is(err, verifier.ErrElementNotFound) {
+			t.Errorf("leaf %s: got %v, want %v", leaf, err, verifier.ErrElementNotFound)
+		}
+	}
+	if index, err := tree.IndexOf(leaves[8]); err != nil || index != 8 {
+		t.Fatalf("leaf next to the revoked one: index %d, %v", index, err)
+	}
+}
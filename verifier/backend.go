@@ -0,0 +1,212 @@
+package verifier
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto/bn256"
+)
+
+// Backend is the curve arithmetic a Verifier runs on. The scalar field work
+// is shared, backends differ in the G1 sums and the pairing
+type Backend int
+
+const (
+	// BackendBigInt is the package's own Fq/G1/G2/Bn128 code on *big.Int
+	BackendBigInt Backend = iota
+	// BackendBN256 is go-ethereum's crypto/bn256, fixed limbs in Montgomery
+	// form with assembly on amd64 and arm64
+	BackendBN256
+)
+
+// DefaultBackend is the backend of NewVerifier and BatchVerify
+var DefaultBackend = BackendBN256
+
+var (
+	curveOnce   sync.Once
+	cachedCurve Bn128
+
+	rootsOnce   sync.Once
+	cachedRoots []*big.Int
+
+	g2Once      sync.Once
+	g2Generator *bn256.G2
+
+	g2PreOnce sync.Once
+	g2Precomp AteG2Precomp
+)
+
+// bn128Curve is the curve with its pairing constants, built on first use.
+// Callers must not modify it
+func bn128Curve() Bn128 {
+	curveOnce.Do(func() {
+		var err error
+		cachedCurve, err = NewBn128()
+		if err != nil {
+			panic(err)
+		}
+	})
+	return cachedCurve
+}
+
+// rootsOfUnity holds at index i a primitive 2^i-th root of unity of Fr,
+// computed on first use. Callers must not modify it
+func rootsOfUnity() []*big.Int {
+	rootsOnce.Do(func() {
+		Fr := NewFq(bn128Curve().R)
+		cachedRoots = calculateSW(Fr.Q, big.NewInt(1), big.NewInt(2), Fr)
+	})
+	return cachedRoots
+}
+
+// toBN256G1 converts a point of the big.Int code, it fails if the point is
+// not on the curve
+func toBN256G1(p [3]*big.Int) (*bn256.G1, error) {
+	a := bn128Curve().G1.Affine(p)
+	buf := make([]byte, 64)
+	a[0].FillBytes(buf[:32])
+	a[1].FillBytes(buf[32:])
+	g := new(bn256.G1)
+	_, err := g.Unmarshal(buf)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func fromBN256G1(g *bn256.G1) G1 {
+	buf := g.Marshal()
+	curve := bn128Curve()
+	x := new(big.Int).SetBytes(buf[:32])
+	y := new(big.Int).SetBytes(buf[32:])
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return G1{curve.Fq1, [3]*big.Int{curve.Fq1.Zero(), curve.Fq1.One(), curve.Fq1.Zero()}}
+	}
+	return NewG1(curve.Fq1, [2]*big.Int{x, y})
+}
+
+// toBN256G2 converts a point of the big.Int code. bn256 encodes the
+// imaginary part of each coordinate first
+func toBN256G2(p [3][2]*big.Int) (*bn256.G2, error) {
+	a := bn128Curve().G2.Affine(p)
+	buf := make([]byte, 128)
+	a[0][1].FillBytes(buf[:32])
+	a[0][0].FillBytes(buf[32:64])
+	a[1][1].FillBytes(buf[64:96])
+	a[1][0].FillBytes(buf[96:])
+	g := new(bn256.G2)
+	_, err := g.Unmarshal(buf)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// bn256G2Generator is the G2 generator of snarkjs as a bn256 point
+func bn256G2Generator() *bn256.G2 {
+	g2Once.Do(func() {
+		var err error
+		g2Generator, err = toBN256G2(bn128Curve().G2.G)
+		if err != nil {
+			panic(err)
+		}
+	})
+	return g2Generator
+}
+
+// g2GeneratorPrecomp is the Miller loop line coefficients of the G2
+// generator, built on first use. Callers must not modify it
+func g2GeneratorPrecomp() AteG2Precomp {
+	g2PreOnce.Do(func() {
+		curve := bn128Curve()
+		g2Precomp = curve.preComputeG2(curve.G2.G)
+	})
+	return g2Precomp
+}
+
+// sumTermsBN256 adds up the terms on bn256 with one multi-scalar multiplication
+func sumTermsBN256(terms []g1Term) (*bn256.G1, error) {
+	points := make([]*bn256.G1, len(terms))
+	scalars := make([]*big.Int, len(terms))
+	for i, t := range terms {
+		p, err := toBN256G1(t.p)
+		if err != nil {
+			return nil, err
+		}
+		points[i], scalars[i] = p, t.s
+	}
+	return MultiScalarMulBN256(points, scalars), nil
+}
+
+// linearizeBN256 computes D, E and F of verifier on bn256
+func linearizeBN256(verifier *Verifier) error {
+	D, err := sumTermsBN256(dTerms(verifier.proof, verifier.challenges, verifier.vk, verifier.EvalLarange[1]))
+	if err != nil {
+		return err
+	}
+	verifier.D = fromBN256G1(D)
+	E, err := sumTermsBN256(eTerms(verifier.proof, verifier.challenges, verifier.T))
+	if err != nil {
+		return err
+	}
+	verifier.E = fromBN256G1(E)
+	F, err := sumTermsBN256(fTerms(verifier.proof, verifier.challenges, verifier.vk, verifier.D))
+	if err != nil {
+		return err
+	}
+	verifier.F = fromBN256G1(F)
+	return nil
+}
+
+// openingCheckBN256 checks e(sum a, X2) = e(sum b, G2) on bn256
+func openingCheckBN256(vk *Vk, a, b []g1Term) bool {
+	A1, err := sumTermsBN256(a)
+	if err != nil {
+		return false
+	}
+	B1, err := sumTermsBN256(b)
+	if err != nil {
+		return false
+	}
+	X2 := vk.prepared().x2
+	if X2 == nil {
+		return false
+	}
+	return bn256.PairingCheck(
+		[]*bn256.G1{A1, new(bn256.G1).Neg(B1)},
+		[]*bn256.G2{X2, bn256G2Generator()},
+	)
+}
+
+// verifyBN256 is verify on bn256
+func verifyBN256(proof *Proof, challenges map[string]*big.Int, vk *Vk, E, F G1) bool {
+	a, b := openingTerms(proof, challenges, vk, E, F)
+	return openingCheckBN256(vk, a, b)
+}
+
+// verifyGroth16BN256 checks the groth16 pairing equation on bn256, vkx are
+// the terms of vk_x
+func verifyGroth16BN256(vk *Groth16Vk, proof *Groth16Proof, vkx []g1Term) bool {
+	x, err := sumTermsBN256(vkx)
+	if err != nil {
+		return false
+	}
+	g1s := make([]*bn256.G1, 3)
+	for i, p := range [][3]*big.Int{proof.A.G, vk.Alpha.G, proof.C.G} {
+		g1s[i], err = toBN256G1(p)
+		if err != nil {
+			return false
+		}
+	}
+	g2s := make([]*bn256.G2, 4)
+	for i, p := range [][3][2]*big.Int{proof.B.G, vk.Beta.G, vk.Gamma.G, vk.Delta.G} {
+		g2s[i], err = toBN256G2(p)
+		if err != nil {
+			return false
+		}
+	}
+	return bn256.PairingCheck(
+		[]*bn256.G1{new(bn256.G1).Neg(g1s[0]), g1s[1], x, g1s[2]},
+		g2s,
+	)
+}
@@ -0,0 +1,89 @@
+package verifier
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// loadPlonk parses the PLONK sample proof in ../test
+func loadPlonk(t testing.TB) (*Vk, *Proof, []*big.Int) {
+	vk, err := ParseVk(readFixture(t, "verification_key.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := ParseProof(readFixture(t, "proof.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ParsePub(readFixture(t, "public.json"), vk.NPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vk, proof, public
+}
+
+// TestBackendsAgree runs the sample proof and broken copies of it through
+// both backends, they must reach the same result and the same D, E and F
+func TestBackendsAgree(t *testing.T) {
+	vk, proof, public := loadPlonk(t)
+	g1 := bn128Curve().G1
+	rnd := rand.New(rand.NewSource(6))
+
+	badEval := *proof
+	badEval.EvalA = new(big.Int).Add(proof.EvalA, big.NewInt(1))
+	badPoint := *proof
+	badPoint.Wxi = G1{g1.F, g1.MulScalar(proof.Wxi.G, big.NewInt(3))}
+	offCurve := *proof
+	offCurve.T1 = NewG1(g1.F, [2]*big.Int{big.NewInt(1), big.NewInt(3)})
+
+	cases := []struct {
+		name   string
+		proof  *Proof
+		public []*big.Int
+		valid  bool
+	}{
+		{"sample", proof, public, true},
+		{"other public signal", proof, []*big.Int{public[0], new(big.Int).Add(public[1], big.NewInt(rnd.Int63()))}, false},
+		{"other evaluation", &badEval, public, false},
+		{"other opening point", &badPoint, public, false},
+		{"point off the curve", &offCurve, public, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			bigInt := NewVerifierWithBackend(vk, tc.proof, tc.public, BackendBigInt)
+			bn256 := NewVerifierWithBackend(vk, tc.proof, tc.public, BackendBN256)
+			if got := bigInt.Verify(); got != tc.valid {
+				t.Errorf("big.Int backend: got %v, want %v", got, tc.valid)
+			}
+			if got := bn256.Verify(); got != tc.valid {
+				t.Errorf("bn256 backend: got %v, want %v", got, tc.valid)
+			}
+			// the bn256 backend refuses points off the curve before it gets to D, E and F
+			if bn256.err != nil {
+				return
+			}
+			for _, p := range []struct {
+				name string
+				a, b G1
+			}{{"D", bigInt.D, bn256.D}, {"E", bigInt.E, bn256.E}, {"F", bigInt.F, bn256.F}} {
+				if !g1.Equal(p.a.G, p.b.G) {
+					t.Errorf("backends disagree on %s", p.name)
+				}
+			}
+		})
+	}
+}
+
+func benchmarkVerify(b *testing.B, backend Backend) {
+	vk, proof, public := loadPlonk(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !NewVerifierWithBackend(vk, proof, public, backend).Verify() {
+			b.Fatal("sample proof rejected")
+		}
+	}
+}
+
+func BenchmarkVerifyBigInt(b *testing.B) { benchmarkVerify(b, BackendBigInt) }
+func BenchmarkVerifyBN256(b *testing.B)  { benchmarkVerify(b, BackendBN256) }
@@ -0,0 +1,106 @@
+package verifier
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// batchScalarBits is the size of the random coefficients of a batch, a bad
+// proof passes the batch with probability 2^-128
+const batchScalarBits = 128
+
+// pairingPair is one term of a product of pairings
+type pairingPair struct {
+	p1 [3]*big.Int
+	p2 AteG2Precomp
+}
+
+// pairingProductIsOne checks prod e(p1, p2) = 1 with one Miller loop per
+// pair and a single final exponentiation
+func pairingProductIsOne(curve Bn128, pairs ...pairingPair) bool {
+	acc := curve.Fq12.One()
+	for _, pair := range pairs {
+		// the pairing with the point at infinity is one
+		if curve.G1.IsZero(pair.p1) {
+			continue
+		}
+		ml := curve.MillerLoop(curve.preComputeG1(pair.p1), pair.p2)
+		acc = curve.Fq12.Mul(acc, ml)
+	}
+	return curve.Fq12.Equal(curve.finalExponentiation(acc), curve.Fq12.One())
+}
+
+// BatchVerify checks PLONK proofs of one verification key together and
+// reports which of them are valid. Every proof must satisfy
+// e(A1_i, X2) = e(B1_i, G2), so with random r_i the whole batch is checked by
+// e(sum r_i A1_i, X2) * e(-sum r_i B1_i, G2) = 1, two Miller loops and one
+// final exponentiation. When that fails each proof is checked on its own to
+// find the bad ones
+func BatchVerify(proofs []*Proof, publics [][]*big.Int, vk *Vk) []bool {
+	valid := make([]bool, len(proofs))
+	if len(publics) != len(proofs) {
+		return valid
+	}
+	Fr := NewFq(bn128Curve().R)
+
+	type opened struct {
+		i    int
+		a, b []g1Term
+	}
+	var batch []opened
+	var batchA, batchB []g1Term
+	for i, proof := range proofs {
+		if proof == nil || len(publics[i]) != vk.NPublic {
+			continue
+		}
+		v := NewVerifier(vk, proof, publics[i])
+		if v.err != nil {
+			continue
+		}
+		a, b := openingTerms(v.proof, v.challenges, v.vk, v.E, v.F)
+		batch = append(batch, opened{i, a, b})
+
+		r, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), batchScalarBits))
+		if err != nil {
+			return valid
+		}
+		r.Add(r, big.NewInt(1))
+		for _, t := range a {
+			batchA = append(batchA, g1Term{t.p, Fr.Mul(t.s, r)})
+		}
+		for _, t := range b {
+			batchB = append(batchB, g1Term{t.p, Fr.Mul(t.s, r)})
+		}
+	}
+	if len(batch) == 0 {
+		return valid
+	}
+
+	if openingCheck(vk, batchA, batchB) {
+		for _, o := range batch {
+			valid[o.i] = true
+		}
+		return valid
+	}
+	for _, o := range batch {
+		valid[o.i] = openingCheck(vk, o.a, o.b)
+	}
+	return valid
+}
+
+// openingCheck checks e(sum a, X2) = e(sum b, G2) on the default backend
+func openingCheck(vk *Vk, a, b []g1Term) bool {
+	if DefaultBackend == BackendBN256 {
+		return openingCheckBN256(vk, a, b)
+	}
+	curve := bn128Curve()
+	return openingPairing(vk.prepared(), sumTerms(curve.G1, a), sumTerms(curve.G1, b))
+}
+
+// openingPairing checks e(A1, X2) = e(B1, G2) with the line coefficients of
+// the prepared key
+func openingPairing(pvk *PreparedVk, A1, B1 [3]*big.Int) bool {
+	curve := bn128Curve()
+	x2Pre, g2Pre := pvk.lines()
+	return pairingProductIsOne(curve, pairingPair{A1, x2Pre}, pairingPair{curve.G1.Neg(B1), g2Pre})
+}
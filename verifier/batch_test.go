@@ -0,0 +1,41 @@
+package verifier
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestBatchVerify(t *testing.T) {
+	vk, proof, public := loadPlonk(t)
+	forged := []*big.Int{public[0], new(big.Int).Add(public[1], big.NewInt(1))}
+
+	cases := []struct {
+		name    string
+		proofs  []*Proof
+		publics [][]*big.Int
+		want    []bool
+	}{
+		{"all valid", []*Proof{proof, proof, proof}, [][]*big.Int{public, public, public}, []bool{true, true, true}},
+		{"forged proof", []*Proof{proof, proof, proof}, [][]*big.Int{public, forged, public}, []bool{true, false, true}},
+		{"only forged", []*Proof{proof}, [][]*big.Int{forged}, []bool{false}},
+		{"nil proof", []*Proof{proof, nil}, [][]*big.Int{public, public}, []bool{true, false}},
+		{"wrong public count", []*Proof{proof, proof}, [][]*big.Int{public, public[:1]}, []bool{true, false}},
+		{"publics of other proofs", []*Proof{proof, proof}, [][]*big.Int{public}, []bool{false, false}},
+		{"empty", nil, nil, []bool{}},
+	}
+	for _, backend := range []Backend{BackendBigInt, BackendBN256} {
+		withBackend(backend, func() {
+			for _, tc := range cases {
+				got := BatchVerify(tc.proofs, tc.publics, vk)
+				if len(got) != len(tc.want) {
+					t.Fatalf("backend %d, %s: got %d results, want %d", backend, tc.name, len(got), len(tc.want))
+				}
+				for i := range got {
+					if got[i] != tc.want[i] {
+						t.Errorf("backend %d, %s: proof %d got %v, want %v", backend, tc.name, i, got[i], tc.want[i])
+					}
+				}
+			}
+		})
+	}
+}
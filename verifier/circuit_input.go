@@ -1,11 +1,84 @@
 package verifier
 
 import (
+	"errors"
 	"math/big"
 	"fmt"
 	"strings"
 )
 
+// Public signals of the vote circuit, in the order the circuit outputs them.
+// A verification key without "signals" must declare NumPublic signals in
+// this order
+const (
+	PubCandidate = iota 	// candidate name as a big-endian number
+	PubNullifier 		// nullifier hash, one vote per voter
+	PubRoot 		// root of the voter tree the proof was made against
+	PubElection 		// election id as a big-endian number, stops replay in other elections
+	NumPublic
+)
+
+// Names of the public signals in the "signals" list of a verification key
+const (
+	SignalCandidate = "candidate"
+	SignalNullifier = "nullifier"
+	SignalRoot      = "root"
+	SignalElection  = "election"
+)
+
+// Signals is the position of each public signal of the vote circuit, -1 if
+// the circuit does not output it
+type Signals struct {
+	Candidate int
+	Nullifier int
+	Root      int
+	Election  int
+}
+
+// DefaultSignals is the layout of a key that does not list its signals
+var DefaultSignals = Signals{PubCandidate, PubNullifier, PubRoot, PubElection}
+
+// SignalLayout reads the "signals" list of a key with nPublic public signals,
+// one name per signal in the order the circuit outputs them. Every circuit
+// outputs the candidate and the nullifier. One that does not output the root
+// or the election id can not be checked against them, so its proofs are not
+// tied to the voter tree or the election by the chain
+func SignalLayout(names []string, nPublic int) (Signals, error) {
+	if names == nil {
+		if nPublic != NumPublic {
+			return Signals{}, fmt.Errorf("expected %d public signals, got %d", NumPublic, nPublic)
+		}
+		return DefaultSignals, nil
+	}
+	if len(names) != nPublic {
+		return Signals{}, fmt.Errorf("%d signal names for %d public signals", len(names), nPublic)
+	}
+	layout := Signals{-1, -1, -1, -1}
+	for i, name := range names {
+		var pos *int
+		switch name {
+		case SignalCandidate:
+			pos = &layout.Candidate
+		case SignalNullifier:
+			pos = &layout.Nullifier
+		case SignalRoot:
+			pos = &layout.Root
+		case SignalElection:
+			pos = &layout.Election
+		default:
+			return Signals{}, fmt.Errorf("unknown public signal %q", name)
+		}
+		if *pos != -1 {
+			return Signals{}, fmt.Errorf("public signal %q is listed twice", name)
+		}
+		*pos = i
+	}
+	if layout.Candidate == -1 || layout.Nullifier == -1 {
+		return Signals{}, errors.New("the candidate and the nullifier must be public signals")
+	}
+	return layout, nil
+}
+
 type Input struct{
 	root *big.Int
     identifier *big.Int
@@ -15,7 +88,7 @@ type Input struct{
 }
 
 
-func genInput(root,identifier,secret,secretHash, voting *big.Int,pathElements map[int]*big.Int, pathIndices map[int]int) (*Input,string,string){
+func genInput(root,identifier,secret,secretHash, voting, election *big.Int,pathElements map[int]*big.Int, pathIndices map[int]int) (*Input,string,string){
 	inp := &Input{
 		root: root,
 		identifier: identifier,
@@ -44,12 +117,45 @@ func genInput(root,identifier,secret,secretHash, voting *big.Int,pathElements ma
 	json += fmt.Sprintf(`"secret": "%s",`+"\n", secret)
 	json += fmt.Sprintf(`"pathElements": %s,`+"\n",  result)
 	json += fmt.Sprintf(`"pathIndices": %s,`+"\n",  result1)
-	json += fmt.Sprintf(`"voting": "%s"`+"\n",  voting)
+	json += fmt.Sprintf(`"voting": "%s",`+"\n",  voting)
+	json += fmt.Sprintf(`"election": "%s"`+"\n",  election)
 	json += fmt.Sprintf("}")
 	var json1 string
 	json1 += fmt.Sprintln("[")
 	json1 += fmt.Sprintf(` "%s",`+"\n",voting)
-	json1 += fmt.Sprintf(` "%s"`+"\n", secretHash)
+	json1 += fmt.Sprintf(` "%s",`+"\n", secretHash)
+	json1 += fmt.Sprintf(` "%s",`+"\n", root)
+	json1 += fmt.Sprintf(` "%s"`+"\n", election)
 	json1 += fmt.Sprintf("]")
 	return inp, json, json1
-}
\ No newline at end of file
+}
+
+// PathInput is the part of the circuit input the chain knows about a leaf,
+// in the same format genInput writes
+type PathInput struct{
+	Root string 		`json:"root"`
+	PathElements []string 	`json:"pathElements"`
+	PathIndices []int 	`json:"pathIndices"`
+	Index int 		`json:"index"`
+}
+
+// NewPathInput reads the merkle path of leaf index from the tree
+func NewPathInput(t *ZkTree, index int) (*PathInput, error) {
+	pathElements, pathIndices, err := t.Path(index)
+	if err != nil {
+		return nil, err
+	}
+	inp := &PathInput{
+		Root: t.GetRoot().String(),
+		PathElements: make([]string, len(pathElements)),
+		PathIndices: make([]int, len(pathIndices)),
+		Index: index,
+	}
+	for i := 0; i < len(pathElements); i++ {
+		inp.PathElements[i] = pathElements[i].String()
+	}
+	for i := 0; i < len(pathIndices); i++ {
+		inp.PathIndices[i] = pathIndices[i]
+	}
+	return inp, nil
+}
@@ -62,10 +62,17 @@ func (g1 G1) Add(p1, p2 [3]*big.Int) [3]*big.Int {
 	s2 := g1.F.Mul(y2, t1)
 
 	h := g1.F.Sub(u2, u1)
+	t3 := g1.F.Sub(s2, s1)
+	// the formula does not hold for p1 = p2 or p1 = -p2
+	if g1.F.IsZero(h) {
+		if g1.F.IsZero(t3) {
+			return g1.Double(p1)
+		}
+		return [3]*big.Int{g1.F.Zero(), g1.F.One(), g1.F.Zero()}
+	}
 	t2 := g1.F.Add(h, h)
 	i := g1.F.Square(t2)
 	j := g1.F.Mul(h, i)
-	t3 := g1.F.Sub(s2, s1)
 	r := g1.F.Add(t3, t3)
 	v := g1.F.Mul(u1, i)
 	t4 := g1.F.Square(r)
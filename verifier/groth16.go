@@ -0,0 +1,173 @@
+package verifier
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// Groth16VkString is a snarkjs groth16 verification_key.json
+type Groth16VkString struct {
+	Protocol string     `json:"protocol"`
+	Curve    string     `json:"curve"`
+	NPublic  int        `json:"nPublic"`
+	Alpha1   []string   `json:"vk_alpha_1"`
+	Beta2    [][]string `json:"vk_beta_2"`
+	Gamma2   [][]string `json:"vk_gamma_2"`
+	Delta2   [][]string `json:"vk_delta_2"`
+	IC       [][]string `json:"IC"`
+	Levels   int        `json:"levels,omitempty"`  // depth of the voter tree the circuit was built for, not part of snarkjs' output
+	Signals  []string   `json:"signals,omitempty"` // name of each public signal, not part of snarkjs' output
+}
+
+// Groth16ProofString is a snarkjs groth16 proof.json
+type Groth16ProofString struct {
+	PiA      []string   `json:"pi_a"`
+	PiB      [][]string `json:"pi_b"`
+	PiC      []string   `json:"pi_c"`
+	Protocol string     `json:"protocol"`
+	Curve    string     `json:"curve"`
+}
+
+// Groth16Vk is a parsed groth16 verification key, IC has one point more
+// than there are public signals
+type Groth16Vk struct {
+	NPublic int
+	Levels  int
+	Signals []string
+	Alpha   G1
+	Beta    G2
+	Gamma   G2
+	Delta   G2
+	IC      []G1
+}
+
+// Groth16Proof is a parsed groth16 proof
+type Groth16Proof struct {
+	A G1
+	B G2
+	C G1
+}
+
+type groth16 struct{}
+
+func (groth16) Protocol() string { return ProtocolGroth16 }
+
+func (groth16) ParseVk(vj []byte) (VerifyingKey, error) {
+	return ParseGroth16Vk(vj)
+}
+
+// checkG2 makes sure a G2 point has both affine coordinates before they are indexed
+func checkG2(points ...[][]string) error {
+	for _, p := range points {
+		if len(p) < 2 || checkPoints(p[0], p[1]) != nil {
+			return errors.New("invalid curve point")
+		}
+	}
+	return nil
+}
+
+func ParseGroth16Vk(vj []byte) (*Groth16Vk, error) {
+	var vr Groth16VkString
+	err := json.Unmarshal(vj, &vr)
+	if err != nil {
+		return nil, err
+	}
+	if vr.Protocol != ProtocolGroth16 {
+		return nil, errors.New("not a groth16 verification key")
+	}
+	err = checkPoints(append([][]string{vr.Alpha1}, vr.IC...)...)
+	if err != nil {
+		return nil, err
+	}
+	err = checkG2(vr.Beta2, vr.Gamma2, vr.Delta2)
+	if err != nil {
+		return nil, err
+	}
+	if vr.NPublic < 0 || len(vr.IC) != vr.NPublic+1 {
+		return nil, errors.New("IC does not match nPublic")
+	}
+	BN128 := bn128Curve()
+
+	v := &Groth16Vk{
+		NPublic: vr.NPublic,
+		Levels:  vr.Levels,
+		Signals: vr.Signals,
+		Alpha:   StringToG1(BN128.Fq1, vr.Alpha1[0], vr.Alpha1[1]),
+		Beta:    StringToG2(BN128.Fq2, vr.Beta2[0], vr.Beta2[1]),
+		Gamma:   StringToG2(BN128.Fq2, vr.Gamma2[0], vr.Gamma2[1]),
+		Delta:   StringToG2(BN128.Fq2, vr.Delta2[0], vr.Delta2[1]),
+		IC:      make([]G1, len(vr.IC)),
+	}
+	for i, p := range vr.IC {
+		v.IC[i] = StringToG1(BN128.Fq1, p[0], p[1])
+	}
+	return v, nil
+}
+
+func ParseGroth16Proof(pj []byte) (*Groth16Proof, error) {
+	var pr Groth16ProofString
+	err := json.Unmarshal(pj, &pr)
+	if err != nil {
+		return nil, err
+	}
+	err = checkPoints(pr.PiA, pr.PiC)
+	if err != nil {
+		return nil, err
+	}
+	err = checkG2(pr.PiB)
+	if err != nil {
+		return nil, err
+	}
+	BN128 := bn128Curve()
+	return &Groth16Proof{
+		A: StringToG1(BN128.Fq1, pr.PiA[0], pr.PiA[1]),
+		B: StringToG2(BN128.Fq2, pr.PiB[0], pr.PiB[1]),
+		C: StringToG1(BN128.Fq1, pr.PiC[0], pr.PiC[1]),
+	}, nil
+}
+
+func (vk *Groth16Vk) Protocol() string      { return ProtocolGroth16 }
+func (vk *Groth16Vk) PublicInputs() int     { return vk.NPublic }
+func (vk *Groth16Vk) TreeLevels() int       { return vk.Levels }
+func (vk *Groth16Vk) SignalNames() []string { return vk.Signals }
+
+func (vk *Groth16Vk) ParseProof(pj []byte) (ZkProof, error) {
+	err := checkProtocol(pj, ProtocolGroth16)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGroth16Proof(pj)
+}
+
+// Verify checks e(A, B) = e(alpha, beta) * e(vk_x, gamma) * e(C, delta)
+// where vk_x = IC[0] + sum public[i] * IC[i+1]. The four Miller loops share
+// one final exponentiation
+func (vk *Groth16Vk) Verify(proof ZkProof, public []*big.Int) bool {
+	p, ok := proof.(*Groth16Proof)
+	if !ok || len(public) != vk.NPublic {
+		return false
+	}
+	curve := bn128Curve()
+	g1 := curve.G1
+	vkxTerms := []g1Term{{vk.IC[0].G, big.NewInt(1)}}
+	for i, s := range public {
+		if s.Sign() < 0 || s.Cmp(curve.R) >= 0 {
+			return false
+		}
+		vkxTerms = append(vkxTerms, g1Term{vk.IC[i+1].G, s})
+	}
+	if DefaultBackend == BackendBN256 {
+		return verifyGroth16BN256(vk, p, vkxTerms)
+	}
+	vkx := sumTerms(g1, vkxTerms)
+
+	return pairingProductIsOne(curve,
+		pairingPair{g1.Neg(p.A.G), curve.preComputeG2(p.B.G)},
+		pairingPair{vk.Alpha.G, curve.preComputeG2(vk.Beta.G)},
+		pairingPair{vkx, curve.preComputeG2(vk.Gamma.G)},
+		pairingPair{p.C.G, curve.preComputeG2(vk.Delta.G)},
+	)
+}
+
+func (proof *Groth16Proof) Protocol() string { return ProtocolGroth16 }
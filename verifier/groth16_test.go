@@ -0,0 +1,179 @@
+package verifier
+
+import (
+	"math/big"
+	"os"
+	"testing"
+)
+
+// readFixture reads a file of the sample proofs in ../test
+func readFixture(t testing.TB, name string) []byte {
+	bz, err := os.ReadFile("../test/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bz
+}
+
+// loadGroth16 parses the groth16 sample. It is not the output of a circuit:
+// it was made from random alpha, beta, gamma, delta and IC scalars with C
+// solved for the pairing equation, in the JSON layout of snarkjs.
+// TestSnarkjsGroth16 checks the output of snarkjs itself
+func loadGroth16(t *testing.T) (VerifyingKey, ZkProof, []*big.Int) {
+	vk, err := ParseVerifyingKey(readFixture(t, "groth16/verification_key.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := vk.ParseProof(readFixture(t, "groth16/proof.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ParsePub(readFixture(t, "groth16/public.json"), vk.PublicInputs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vk, proof, public
+}
+
+// withBackend runs f with DefaultBackend set to backend
+func withBackend(backend Backend, f func()) {
+	saved := DefaultBackend
+	defer func() { DefaultBackend = saved }()
+	DefaultBackend = backend
+	f()
+}
+
+func TestGroth16Fixture(t *testing.T) {
+	vk, proof, public := loadGroth16(t)
+	if vk.Protocol() != ProtocolGroth16 || vk.PublicInputs() != NumPublic {
+		t.Fatalf("got a %s key with %d public signals", vk.Protocol(), vk.PublicInputs())
+	}
+	tampered := append([]*big.Int{new(big.Int).Add(public[0], big.NewInt(1))}, public[1:]...)
+	for _, backend := range []Backend{BackendBigInt, BackendBN256} {
+		withBackend(backend, func() {
+			if !vk.Verify(proof, public) {
+				t.Errorf("backend %d: valid proof rejected", backend)
+			}
+			if vk.Verify(proof, tampered) {
+				t.Errorf("backend %d: tampered public signal accepted", backend)
+			}
+			if vk.Verify(proof, public[1:]) || vk.Verify(proof, append(public, big.NewInt(1))) {
+				t.Errorf("backend %d: wrong number of public signals accepted", backend)
+			}
+			outOfField := append([]*big.Int{new(big.Int).Add(public[0], FieldSize)}, public[1:]...)
+			if vk.Verify(proof, outOfField) {
+				t.Errorf("backend %d: public signal outside the field accepted", backend)
+			}
+		})
+	}
+}
+
+// TestSnarkjsGroth16 verifies a key and proof exported by snarkjs, made by
+// test/groth16/snarkjs.sh since circom and snarkjs are not part of the build
+func TestSnarkjsGroth16(t *testing.T) {
+	if _, err := os.Stat("../test/groth16/snarkjs/proof.json"); os.IsNotExist(err) {
+		t.Skip("no snarkjs sample, run test/groth16/snarkjs.sh")
+	}
+	vk, err := ParseVerifyingKey(readFixture(t, "groth16/snarkjs/verification_key.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := vk.ParseProof(readFixture(t, "groth16/snarkjs/proof.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ParsePub(readFixture(t, "groth16/snarkjs/public.json"), vk.PublicInputs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]*big.Int{new(big.Int).Add(public[0], big.NewInt(1))}, public[1:]...)
+	for _, backend := range []Backend{BackendBigInt, BackendBN256} {
+		withBackend(backend, func() {
+			if !vk.Verify(proof, public) {
+				t.Errorf("backend %d: snarkjs proof rejected", backend)
+			}
+			if vk.Verify(proof, tampered) {
+				t.Errorf("backend %d: tampered public signal accepted", backend)
+			}
+		})
+	}
+}
+
+func TestProtocolMismatch(t *testing.T) {
+	groth, grothProof, _ := loadGroth16(t)
+	plonk, err := ParseVerifyingKey(readFixture(t, "verification_key.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plonkProof, err := plonk.ParseProof(readFixture(t, "proof.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := groth.ParseProof(readFixture(t, "proof.json")); err == nil {
+		t.Error("groth16 key parsed a plonk proof")
+	}
+	if _, err := plonk.ParseProof(readFixture(t, "groth16/proof.json")); err == nil {
+		t.Error("plonk key parsed a groth16 proof")
+	}
+	public := make([]*big.Int, NumPublic)
+	for i := range public {
+		public[i] = big.NewInt(1)
+	}
+	if groth.Verify(plonkProof, public) || plonk.Verify(grothProof, public[:plonk.PublicInputs()]) {
+		t.Error("proof of another protocol accepted")
+	}
+}
+
+// TestPlonkPublicLength checks that a wrong number of public signals fails
+// instead of indexing past the key
+func TestPlonkPublicLength(t *testing.T) {
+	vk, err := ParseVerifyingKey(readFixture(t, "verification_key.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := vk.ParseProof(readFixture(t, "proof.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ParsePub(readFixture(t, "public.json"), vk.PublicInputs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vk.Verify(proof, public) {
+		t.Fatal("sample proof rejected")
+	}
+	for _, n := range []int{0, vk.PublicInputs() - 1, vk.PublicInputs() + 1} {
+		wrong := make([]*big.Int, n)
+		for i := range wrong {
+			wrong[i] = big.NewInt(1)
+		}
+		copy(wrong, public)
+		if vk.Verify(proof, wrong) {
+			t.Errorf("%d public signals accepted", n)
+		}
+	}
+}
+
+func TestSignalLayout(t *testing.T) {
+	cases := []struct {
+		names   []string
+		nPublic int
+		want    Signals
+		ok      bool
+	}{
+		{nil, NumPublic, DefaultSignals, true},
+		{nil, 2, Signals{}, false},
+		{[]string{SignalCandidate, SignalNullifier}, 2, Signals{0, 1, -1, -1}, true},
+		{[]string{SignalElection, SignalRoot, SignalNullifier, SignalCandidate}, 4, Signals{3, 2, 1, 0}, true},
+		{[]string{SignalCandidate, SignalNullifier}, 3, Signals{}, false},
+		{[]string{SignalCandidate, SignalRoot}, 2, Signals{}, false},
+		{[]string{SignalCandidate, SignalNullifier, SignalCandidate}, 3, Signals{}, false},
+		{[]string{SignalCandidate, SignalNullifier, "weight"}, 3, Signals{}, false},
+	}
+	for _, tc := range cases {
+		got, err := SignalLayout(tc.names, tc.nPublic)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("SignalLayout(%v, %d) = %+v, %v", tc.names, tc.nPublic, got, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package verifier
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/iden3/go-iden3-crypto/poseidon"
+)
+
+// Hasher hashes two children of the voter tree into their parent. It must
+// match the hash the vote circuit uses for its merkle proof
+type Hasher interface {
+	HashLeftRight(left, right *big.Int) (*big.Int, error)
+}
+
+// FieldSize is the scalar field of bn128, every node of the tree is below it
+var FieldSize, _ = new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+
+// InField reports whether x can be a leaf of the tree
+func InField(x *big.Int) bool {
+	return x.Sign() >= 0 && x.Cmp(FieldSize) < 0
+}
+
+// Names of the supported tree hashes
+const (
+	HashMimcSponge = "mimcsponge"
+	HashPoseidon   = "poseidon"
+)
+
+// NewHasher returns the hasher called name, MiMCSponge if name is empty
+func NewHasher(name string) (Hasher, error) {
+	switch name {
+	case "", HashMimcSponge:
+		return NewMimcSponge(), nil
+	case HashPoseidon:
+		return Poseidon{}, nil
+	}
+	return nil, fmt.Errorf("unsupported hash %q", name)
+}
+
+// HashLeftRight is circomlib's MiMCSponge(2, 220, 1) with a zero key, as in
+// Tornado's MerkleTreeWithHistory
+func (ms *MimcSponge) HashLeftRight(left, right *big.Int) (*big.Int, error) {
+	out, err := ms.MultiHash([]*big.Int{left, right}, nil, 1)
+	if err != nil {
+		return nil, err
+	}
+	return out[0], nil
+}
+
+// Poseidon is circomlib's Poseidon(2), far cheaper than MiMCSponge in a circuit
+type Poseidon struct{}
+
+func (Poseidon) HashLeftRight(left, right *big.Int) (*big.Int, error) {
+	return poseidon.Hash([]*big.Int{left, right})
+}
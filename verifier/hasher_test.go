@@ -0,0 +1,56 @@
+package verifier
+
+import (
+	"math/big"
+	"testing"
+)
+
+func bigInt(t *testing.T, s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		t.Fatalf("invalid number %s", s)
+	}
+	return n
+}
+
+// The MiMCSponge vectors are the zeros of Tornado's MerkleTreeWithHistory,
+// each one is HashLeftRight of the one before with itself. The Poseidon
+// vectors are circomlibjs poseidon([1, 2]) and poseidon([0, 0])
+func TestHasherVectors(t *testing.T) {
+	zero := "21663839004416932945382355908790599225266501822907911457504978515578255421292"
+	cases := []struct {
+		hasher      string
+		left, right string
+		want        string
+	}{
+		{HashMimcSponge, zero, zero, "0x256a6135777eee2fd26f54b8b7037a25439d5235caee224154186d2b8a52e31d"},
+		{HashMimcSponge, "0x256a6135777eee2fd26f54b8b7037a25439d5235caee224154186d2b8a52e31d", "0x256a6135777eee2fd26f54b8b7037a25439d5235caee224154186d2b8a52e31d", "0x1151949895e82ab19924de92c40a3d6f7bcb60d92b00504b8199613683f0c200"},
+		{HashMimcSponge, "0x1151949895e82ab19924de92c40a3d6f7bcb60d92b00504b8199613683f0c200", "0x1151949895e82ab19924de92c40a3d6f7bcb60d92b00504b8199613683f0c200", "0x20121ee811489ff8d61f09fb89e313f14959a0f28bb428a20dba6b0b068b3bdb"},
+		{HashPoseidon, "1", "2", "7853200120776062878684798364095072458815029376092732009249414926327459813530"},
+		{HashPoseidon, "0", "0", "0x2098f5fb9e239eab3ceac3f27b81e481dc3124d55ffed523a839ee8446b64864"},
+	}
+	for _, tc := range cases {
+		hasher, err := NewHasher(tc.hasher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := hasher.HashLeftRight(bigInt(t, tc.left), bigInt(t, tc.right))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := bigInt(t, tc.want); got.Cmp(want) != 0 {
+			t.Errorf("%s(%s, %s) = %s, want %s", tc.hasher, tc.left, tc.right, got, want)
+		}
+	}
+}
+
+func TestNewHasher(t *testing.T) {
+	for _, name := range []string{"", HashMimcSponge, HashPoseidon} {
+		if _, err := NewHasher(name); err != nil {
+			t.Errorf("NewHasher(%q): %v", name, err)
+		}
+	}
+	if _, err := NewHasher("sha256"); err == nil {
+		t.Error("NewHasher accepted an unsupported hash")
+	}
+}
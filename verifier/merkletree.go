@@ -2,204 +2,457 @@ package verifier
 
 import (
 	"errors"
+	"fmt"
 	"math/big"
+	"runtime"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto"
 )
+
+// RootHistorySize is how many recent roots IsKnownRoot accepts, like
+// Tornado's ROOT_HISTORY_SIZE, so a proof made just before another
+// registration changed the root is still valid
+const RootHistorySize = 30
+
+// Errors returned by ZkTree, wrapped with the details
+var (
+	ErrTreeFull        = errors.New("merkle tree is full")
+	ErrIndexOutOfRange = errors.New("leaf index out of range")
+	ErrElementNotFound = errors.New("element not found in merkle tree")
+	ErrHashFailed      = errors.New("merkle tree hash failed")
+)
+
+// NodeStore keeps the non-zero nodes of a ZkTree. Level 0 holds the leaves,
+// a node that was never set is the zero value of its level
+type NodeStore interface {
+	Get(level, index int) (*big.Int, error) // nil if the node was never set
+	Set(level, index int, node *big.Int) error
+}
+
+// LeafIndex is implemented by a NodeStore that can find a leaf by its value,
+// IndexOf then looks the leaf up instead of reading every leaf
+type LeafIndex interface {
+	// LeafIndex returns the index leaf was last set at, false if it never was
+	LeafIndex(leaf *big.Int) (int, bool, error)
+}
+
+// MemStore is a NodeStore in memory
+type MemStore map[[2]int]*big.Int
+
+func (s MemStore) Get(level, index int) (*big.Int, error) {
+	return s[[2]int{level, index}], nil
+}
+
+func (s MemStore) Set(level, index int, node *big.Int) error {
+	s[[2]int{level, index}] = node
+	return nil
+}
+
+// ZkTree is an append only merkle tree of fixed depth. Only the nodes on the
+// left of the next leaf are stored, an insert hashes one node per level and
+// a path reads one sibling per level
 type ZkTree struct {
 	levels           int
 	nextIndex        int
 	currentRootIndex int
-	filledsubTree    map[int]*big.Int
-	roots            map[int]*big.Int
-	layer            map[int][]*big.Int
-	zeroes 			 map[int]*big.Int
-	hasher			 *MimcSponge
+	roots            map[int]*big.Int // ring buffer of the last RootHistorySize roots
+	zeroes           map[int]*big.Int // root of an empty subtree of each level
+	hasher           Hasher
+	store            NodeStore
 }
 
+// NewZkTree builds a tree in memory holding elements
+func NewZkTree(levels int, elements []*big.Int) (*ZkTree, error) {
+	if len(elements) > (1 << levels) {
+		return nil, fmt.Errorf("%w: %d elements for depth %d", ErrTreeFull, len(elements), levels)
+	}
+	t, err := NewZkTreeWithStore(levels, MemStore{}, NewMimcSponge())
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range elements {
+		_, err := t.QuickInsert(element)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
 
-
-func (t *ZkTree) QuickInsert(leaf *big.Int) (int, error) {
-	nextIndex := t.nextIndex
-	if nextIndex >= 1<<t.levels {
-		return -1, errors.New("Merkle tree is full. No more leaves can be added")
+// NewZkTreeWithStore builds an empty tree whose nodes are kept in store
+func NewZkTreeWithStore(levels int, store NodeStore, hasher Hasher) (*ZkTree, error) {
+	t := &ZkTree{
+		levels: levels,
+		roots:  make(map[int]*big.Int),
+		zeroes: make(map[int]*big.Int),
+		hasher: hasher,
+		store:  store,
 	}
-	t.layer[0] = append(t.layer[0],leaf)
-	currentIndex := nextIndex
-	currentLevelHash := leaf
-	var left, right *big.Int
+	err := t.generateZeroes()
+	if err != nil {
+		return nil, err
+	}
+	// root of the tree before any QuickInsert
+	t.roots[0] = t.zeroes[levels]
+	return t, nil
+}
 
-	for i := 0; i < t.levels; i++ {
-		if currentIndex%2 == 0 {
-			left = currentLevelHash
-			right = t.zeroes[i]
-			t.filledsubTree[i] = currentLevelHash
-		} else {
-			left = t.filledsubTree[i]
-			right = currentLevelHash
+// LoadZkTree opens a tree of size leaves that is already in store, roots and
+// current are the root history as returned by History
+func LoadZkTree(levels int, store NodeStore, hasher Hasher, size int, roots []*big.Int, current int) (*ZkTree, error) {
+	if size < 0 || size > 1<<levels || len(roots) > RootHistorySize || current < 0 || current >= RootHistorySize {
+		return nil, errors.New("invalid tree metadata")
+	}
+	t, err := NewZkTreeWithStore(levels, store, hasher)
+	if err != nil {
+		return nil, err
+	}
+	t.nextIndex = size
+	t.roots = make(map[int]*big.Int)
+	for i, root := range roots {
+		if root != nil {
+			t.roots[i] = root
 		}
-		temp_out,_ := t.hasher.MultiHash([]*big.Int{left, right},nil,1)
-		currentLevelHash = temp_out[0]
-		currentIndex /= 2
 	}
-
-	newRootIndex := (t.currentRootIndex + 1) 
-	t.currentRootIndex = newRootIndex
-	t.roots[newRootIndex] = currentLevelHash
-	t.nextIndex = nextIndex + 1
-	return nextIndex, nil
+	t.currentRootIndex = current
+	if t.GetRoot() == nil {
+		return nil, errors.New("missing current root")
+	}
+	return t, nil
 }
 
-// func (t *zkTree) isKnownRoot(root big.Int) (bool){
-// 	if root == *nil {
-// 		return false
-// 	}
-// 	if root == t.getRoot() {
-// 		return true
-// 	} else {
-// 		return false
-// 	}
+func (t *ZkTree) generateZeroes() error {
+	zero := new(big.Int)
+	zero.SetString("21663839004416932945382355908790599225266501822907911457504978515578255421292", 10) // keccak256("tornado") % Field
+	t.zeroes[0] = zero
+	for i := 1; i <= t.levels; i++ {
+		hash, err := t.hash(t.zeroes[i-1], t.zeroes[i-1])
+		if err != nil {
+			return err
+		}
+		t.zeroes[i] = hash
+	}
+	return nil
+}
 
-// }
+// hash is the parent of left and right
+func (t *ZkTree) hash(left, right *big.Int) (*big.Int, error) {
+	hash, err := t.hasher.HashLeftRight(left, right)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHashFailed, err)
+	}
+	return hash, nil
+}
 
-func (t *ZkTree) GetRoot() (*big.Int){
-	return t.roots[t.currentRootIndex]
+// node returns the node at level and index, or the zero value of the level
+func (t *ZkTree) node(level, index int) (*big.Int, error) {
+	node, err := t.store.Get(level, index)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return t.zeroes[level], nil
+	}
+	return node, nil
 }
 
+// CheckLeaf returns the error inserting leaf would fail with, so a caller
+// that inserts later can reject it up front
+func (t *ZkTree) CheckLeaf(leaf *big.Int) error {
+	if !InField(leaf) {
+		return fmt.Errorf("%w: leaf is not a field element", ErrHashFailed)
+	}
+	_, err := t.hash(leaf, t.zeroes[0])
+	return err
+}
 
-func (t *ZkTree) generateZeroes()  {
-	zero := new(big.Int)
-	zero.SetString("21663839004416932945382355908790599225266501822907911457504978515578255421292",10) // keccak256("tornado") % Field
-	t.zeroes[0] = zero
-	t.filledsubTree[0] = zero
-	for i := 1; i <= t.levels; i++{
-		
-		temp_out,_ := t.hasher.MultiHash([]*big.Int{t.zeroes[i-1],t.zeroes[i-1]},nil,1)
-		t.zeroes[i] = temp_out[0]
-		t.filledsubTree[i] = temp_out[0]
+// QuickInsert appends leaf and returns its index
+func (t *ZkTree) QuickInsert(leaf *big.Int) (int, error) {
+	nextIndex := t.nextIndex
+	if nextIndex >= 1<<t.levels {
+		return -1, fmt.Errorf("%w: %d leaves", ErrTreeFull, nextIndex)
+	}
+	err := t.store.Set(0, nextIndex, leaf)
+	if err != nil {
+		return -1, err
 	}
-	
+	root, err := t.updatePath(nextIndex, leaf)
+	if err != nil {
+		return -1, err
+	}
+	t.pushRoot(root)
+	t.nextIndex = nextIndex + 1
+	return nextIndex, nil
 }
 
-func (t *ZkTree) indexOf(element *big.Int) int {
-	for i := 0; i < len(t.layer[0]); i++ {
-		if t.layer[0][i].Cmp(element) == 0 {
-			return i
+// updatePath rehashes the nodes above leaf index and returns the new root
+func (t *ZkTree) updatePath(index int, leaf *big.Int) (*big.Int, error) {
+	currentIndex := index
+	currentLevelHash := leaf
+	for level := 0; level < t.levels; level++ {
+		sibling, err := t.node(level, currentIndex^1)
+		if err != nil {
+			return nil, err
+		}
+		left, right := currentLevelHash, sibling
+		if currentIndex%2 == 1 {
+			left, right = sibling, currentLevelHash
+		}
+		currentLevelHash, err = t.hash(left, right)
+		if err != nil {
+			return nil, err
+		}
+		currentIndex /= 2
+		if level+1 < t.levels {
+			err = t.store.Set(level+1, currentIndex, currentLevelHash)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
-	return -1
+	return currentLevelHash, nil
 }
 
-func (t *ZkTree) insert(element *big.Int) error {
-	if len(t.layer[0]) >= 1<<t.levels {
-		return errors.New("tree is full")
+// BatchInsert appends leaves with a single root update. Every node above the
+// new leaves is hashed once, levels with many nodes are split across
+// goroutines. It returns the index of the first leaf
+func (t *ZkTree) BatchInsert(leaves []*big.Int) (int, error) {
+	start := t.nextIndex
+	if len(leaves) == 0 {
+		return start, nil
 	}
-	t.update(len(t.layer[0]), element)
-	
-	return nil
+	if len(leaves) > 1<<t.levels-start {
+		return -1, fmt.Errorf("%w: %d leaves, %d more", ErrTreeFull, start, len(leaves))
+	}
+	// nodes holds the changed nodes of the current level, from index lo
+	lo := start
+	nodes := append([]*big.Int(nil), leaves...)
+	for i, leaf := range leaves {
+		err := t.store.Set(0, start+i, leaf)
+		if err != nil {
+			return -1, err
+		}
+	}
+	for level := 0; level < t.levels; level++ {
+		// a changed range starting on a right child needs its stored left sibling,
+		// the node right of the range is always empty
+		if lo%2 == 1 {
+			left, err := t.node(level, lo-1)
+			if err != nil {
+				return -1, err
+			}
+			nodes = append([]*big.Int{left}, nodes...)
+			lo--
+		}
+		if len(nodes)%2 == 1 {
+			nodes = append(nodes, t.zeroes[level])
+		}
+		parents, err := t.hashPairs(nodes)
+		if err != nil {
+			return -1, err
+		}
+		lo /= 2
+		nodes = parents
+		if level+1 < t.levels {
+			for i, node := range nodes {
+				err = t.store.Set(level+1, lo+i, node)
+				if err != nil {
+					return -1, err
+				}
+			}
+		}
+	}
+	t.pushRoot(nodes[0])
+	t.nextIndex = start + len(leaves)
+	return start, nil
 }
 
+// Tombstone replaces a revoked leaf, it is keccak256("revoked") % Field so
+// nobody knows a commitment that hashes to it
+var Tombstone = new(big.Int).Mod(new(big.Int).SetBytes(crypto.Keccak256([]byte("revoked"))), FieldSize)
 
-func (t *ZkTree) update(index int, element *big.Int) error {
-	if index < 0 || index > len(t.layer[0]) || index >= 1<<t.levels {
-		return errors.New("insert index out of bounds: " + string(index))
+// Revoke replaces the leaf at index with Tombstone and rehashes its path.
+// The root history is reset to the new root, every older root still
+// contains the leaf and would keep accepting its membership proofs
+func (t *ZkTree) Revoke(index int) error {
+	leaf, err := t.Leaf(index)
+	if err != nil {
+		return err
+	}
+	if leaf.Cmp(Tombstone) == 0 {
+		return fmt.Errorf("leaf %d is already revoked", index)
 	}
-	t.layer[0] = append(t.layer[0],element)
-	
-	t.processUpdate(index)
+	err = t.store.Set(0, index, Tombstone)
+	if err != nil {
+		return err
+	}
+	root, err := t.updatePath(index, Tombstone)
+	if err != nil {
+		return err
+	}
+	t.roots = map[int]*big.Int{0: root}
+	t.currentRootIndex = 0
 	return nil
 }
 
-func (t *ZkTree) path(index int) (map[int]*big.Int, map[int]int, error) {
-	if index < 0 || index >= len(t.layer[0]) {
-		return nil, nil, errors.New("index out of bounds: " + string(index))
-	}
-	elIndex := index
-	pathElements := make(map[int]*big.Int)
-	pathIndices := make(map[int]int)
-	for level := 0; level < t.levels; level++ {
-		pathIndices[level] = elIndex % 2
-		leafIndex := elIndex ^ 1
-		if leafIndex < len(t.layer[level]) {
-			pathElements[level] = t.layer[level][leafIndex]
-		} else {
-			pathElements[level] = t.zeroes[level] // replace with zero element
+// minParallelPairs is the number of pairs below which hashPairs stays on one goroutine
+const minParallelPairs = 64
+
+// hashPairs hashes nodes two by two into their parents
+func (t *ZkTree) hashPairs(nodes []*big.Int) ([]*big.Int, error) {
+	parents := make([]*big.Int, len(nodes)/2)
+	workers := runtime.GOMAXPROCS(0)
+	if len(parents) < minParallelPairs || workers == 1 {
+		for i := range parents {
+			hash, err := t.hash(nodes[2*i], nodes[2*i+1])
+			if err != nil {
+				return nil, err
+			}
+			parents[i] = hash
 		}
-		elIndex >>= 1
+		return parents, nil
 	}
-	return pathElements, pathIndices, nil
-}
 
-func (t *ZkTree) processNodes(nodes []*big.Int, layerIndex int) []*big.Int {
-	length := len(nodes)
-	
-	currentLength := (length + 1) / 2
-	currentLayer := make([]*big.Int, currentLength)
-	currentLength--
-	startFrom := length - ((length % 2) ^ 1)
-	j := 0
-	for i := startFrom; i >= 0; i -= 2 {
-		if i-1 < 0 {
+	chunk := (len(parents) + workers - 1) / workers
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		from, to := w*chunk, (w+1)*chunk
+		if to > len(parents) {
+			to = len(parents)
+		}
+		if from >= to {
 			break
 		}
-		left := nodes[i-1]
-		var right *big.Int
-		if i == startFrom && length%2 == 1 {
-			right = t.zeroes[layerIndex-1] // replace with zero element of the level
-		} else {
-			right = nodes[i]
+		wg.Add(1)
+		go func(w, from, to int) {
+			defer wg.Done()
+			for i := from; i < to; i++ {
+				hash, err := t.hash(nodes[2*i], nodes[2*i+1])
+				if err != nil {
+					errs[w] = err
+					return
+				}
+				parents[i] = hash
+			}
+		}(w, from, to)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
 		}
-		temp_out,_ := t.hasher.MultiHash([]*big.Int{left, right},nil,1)
-		currentLayer[currentLength-j] = temp_out[0]
-		j++
 	}
-	return currentLayer
+	return parents, nil
 }
 
-func (t *ZkTree) processUpdate(index int) {
-	for level := 1; level <= t.levels; level++ {
-		index >>= 1
-		left := t.layer[level-1][index*2]
-		rightIndex := index*2 + 1
-		var right *big.Int
-		if rightIndex < len(t.layer[level-1]) {
-			right = t.layer[level-1][rightIndex]
+// Capacity is the number of leaves the tree can hold
+func (t *ZkTree) Capacity() int {
+	return 1 << t.levels
+}
 
-		} else {
-			right = t.zeroes[level-1] 
+func (t *ZkTree) pushRoot(root *big.Int) {
+	newRootIndex := (t.currentRootIndex + 1) % RootHistorySize
+	t.currentRootIndex = newRootIndex
+	t.roots[newRootIndex] = root
+}
+
+// IsKnownRoot reports whether root is one of the last RootHistorySize roots
+func (t *ZkTree) IsKnownRoot(root *big.Int) bool {
+	if root == nil || root.Sign() == 0 {
+		return false
+	}
+	i := t.currentRootIndex
+	for n := 0; n < RootHistorySize; n++ {
+		if r, ok := t.roots[i]; ok && r.Cmp(root) == 0 {
+			return true
+		}
+		if i == 0 {
+			i = RootHistorySize
 		}
-		
-		temp_out,_ := t.hasher.MultiHash([]*big.Int{left, right},nil,1)
-		t.layer[level][index] = temp_out[0]
+		i--
 	}
+	return false
 }
-func (t *ZkTree) buildHashes() {
-	for layerIndex := 1; layerIndex <= t.levels; layerIndex++ {
-		nodes := t.layer[layerIndex-1]
-		t.layer[layerIndex] = t.processNodes(nodes, layerIndex)
-	}
+
+func (t *ZkTree) GetRoot() *big.Int {
+	return t.roots[t.currentRootIndex]
 }
 
-func NewZkTree(levels int, elements []*big.Int) (*ZkTree, error) {
-	if len(elements) > (1 << levels) {
-		return nil, errors.New("tree is full")
+// History returns the root ring buffer and the position of the current root
+func (t *ZkTree) History() ([]*big.Int, int) {
+	roots := make([]*big.Int, RootHistorySize)
+	for i := range roots {
+		roots[i] = t.roots[i]
 	}
-	t := &ZkTree{
-		levels:        levels,
-		filledsubTree: make(map[int]*big.Int),
-		roots:         make(map[int]*big.Int),
-		layer:         make(map[int][]*big.Int),
-		zeroes: make(map[int]*big.Int),
-		nextIndex: 0,
-		currentRootIndex: 0,
-		hasher: NewMimcSponge(),
+	return roots, t.currentRootIndex
+}
+
+// Size is the number of leaves in the tree
+func (t *ZkTree) Size() int {
+	return t.nextIndex
+}
+
+// Leaf returns the leaf at index
+func (t *ZkTree) Leaf(index int) (*big.Int, error) {
+	if index < 0 || index >= t.nextIndex {
+		return nil, fmt.Errorf("%w: %d of %d", ErrIndexOutOfRange, index, t.nextIndex)
 	}
-	
-	t.layer[0] = elements
-	
-	t.generateZeroes()
+	return t.node(0, index)
+}
 
-	t.buildHashes()
+// IndexOf returns the index of a leaf
+func (t *ZkTree) IndexOf(element *big.Int) (int, error) {
+	if index, ok := t.store.(LeafIndex); ok {
+		i, found, err := index.LeafIndex(element)
+		if err != nil {
+			return -1, err
+		}
+		if !found || i >= t.nextIndex {
+			return -1, ErrElementNotFound
+		}
+		// a revoked leaf keeps its index key, its node no longer matches
+		leaf, err := t.node(0, i)
+		if err != nil {
+			return -1, err
+		}
+		if leaf.Cmp(element) != 0 {
+			return -1, ErrElementNotFound
+		}
+		return i, nil
+	}
+	for i := 0; i < t.nextIndex; i++ {
+		leaf, err := t.node(0, i)
+		if err != nil {
+			return -1, err
+		}
+		if leaf.Cmp(element) == 0 {
+			return i, nil
+		}
+	}
+	return -1, ErrElementNotFound
+}
 
-	return t, nil
+// Path returns the sibling of every level on the way from leaf index to the
+// root and whether the node is the left (0) or right (1) child
+func (t *ZkTree) Path(index int) (map[int]*big.Int, map[int]int, error) {
+	if index < 0 || index >= t.nextIndex {
+		return nil, nil, fmt.Errorf("%w: %d of %d", ErrIndexOutOfRange, index, t.nextIndex)
+	}
+	elIndex := index
+	pathElements := make(map[int]*big.Int)
+	pathIndices := make(map[int]int)
+	for level := 0; level < t.levels; level++ {
+		sibling, err := t.node(level, elIndex^1)
+		if err != nil {
+			return nil, nil, err
+		}
+		pathIndices[level] = elIndex % 2
+		pathElements[level] = sibling
+		elIndex >>= 1
+	}
+	return pathElements, pathIndices, nil
 }
 
 func (t *ZkTree) checkMerkleProof(pathElements map[int]*big.Int, pathIndices map[int]int, element *big.Int) (*big.Int, error) {
@@ -213,19 +466,14 @@ func (t *ZkTree) checkMerkleProof(pathElements map[int]*big.Int, pathIndices map
 		}
 		in1 = pathElements[i]
 
-		if pathIndices[i] == 0 {
-			temp_out, err := t.hasher.MultiHash([]*big.Int{in0, in1}, nil, 1)
-			if err != nil {
-				return nil, err
-			}
-			hashes[i] = temp_out[0]
-		} else {
-			temp_out, err := t.hasher.MultiHash([]*big.Int{in1, in0}, nil, 1)
-			if err != nil {
-				return nil, err
-			}
-			hashes[i] = temp_out[0]
+		if pathIndices[i] == 1 {
+			in0, in1 = in1, in0
+		}
+		hash, err := t.hash(in0, in1)
+		if err != nil {
+			return nil, err
 		}
+		hashes[i] = hash
 	}
 	return hashes[t.levels-1], nil
 }
@@ -0,0 +1,343 @@
+package verifier
+
+import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// randomLeaves returns n random field elements
+func randomLeaves(rnd *rand.Rand, n int) []*big.Int {
+	leaves := make([]*big.Int, n)
+	for i := range leaves {
+		leaves[i] = new(big.Int).Rand(rnd, FieldSize)
+	}
+	return leaves
+}
+
+// fullRoot hashes every level of a tree of depth levels holding leaves, the
+// way the tree was computed before it was stored sparsely
+func fullRoot(t *testing.T, hasher Hasher, levels int, leaves []*big.Int) *big.Int {
+	tree, err := NewZkTreeWithStore(levels, MemStore{}, hasher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := make([]*big.Int, 1<<levels)
+	for i := range nodes {
+		nodes[i] = tree.zeroes[0]
+		if i < len(leaves) {
+			nodes[i] = leaves[i]
+		}
+	}
+	for len(nodes) > 1 {
+		parents := make([]*big.Int, len(nodes)/2)
+		for i := range parents {
+			parents[i], err = hasher.HashLeftRight(nodes[2*i], nodes[2*i+1])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		nodes = parents
+	}
+	return nodes[0]
+}
+
+// TestZkTreeRandomInserts inserts random leaves and checks after every insert
+// that the root matches a full recomputation and that the path of every leaf
+// hashes back to the root
+func TestZkTreeRandomInserts(t *testing.T) {
+	const levels = 4
+	rnd := rand.New(rand.NewSource(1))
+	for _, hasher := range []Hasher{NewMimcSponge(), Poseidon{}} {
+		for run := 0; run < 3; run++ {
+			leaves := randomLeaves(rnd, 1+rnd.Intn(1<<levels))
+			tree, err := NewZkTreeWithStore(levels, MemStore{}, hasher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for n, leaf := range leaves {
+				index, err := tree.QuickInsert(leaf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if index != n {
+					t.Fatalf("leaf %d inserted at %d", n, index)
+				}
+				root := tree.GetRoot()
+				if want := fullRoot(t, hasher, levels, leaves[:n+1]); root.Cmp(want) != 0 {
+					t.Fatalf("%T run %d: root after %d leaves is %s, want %s", hasher, run, n+1, root, want)
+				}
+				if !tree.IsKnownRoot(root) {
+					t.Fatal("current root is not known")
+				}
+				for i := 0; i <= n; i++ {
+					elements, indices, err := tree.Path(i)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got, err := tree.checkMerkleProof(elements, indices, leaves[i])
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got.Cmp(root) != 0 {
+						t.Fatalf("%T run %d: path of leaf %d of %d does not lead to the root", hasher, run, i, n+1)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestZkTreeReload checks that a tree opened from its store and history
+// carries on exactly like the original
+func TestZkTreeReload(t *testing.T) {
+	const levels = 5
+	rnd := rand.New(rand.NewSource(2))
+	leaves := randomLeaves(rnd, 12)
+	store := MemStore{}
+	tree, err := NewZkTreeWithStore(levels, store, NewMimcSponge())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaf := range leaves[:7] {
+		_, err = tree.QuickInsert(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	roots, current := tree.History()
+	reloaded, err := LoadZkTree(levels, store, NewMimcSponge(), tree.Size(), roots, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaf := range leaves[7:] {
+		_, err = reloaded.QuickInsert(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := fullRoot(t, NewMimcSponge(), levels, leaves); reloaded.GetRoot().Cmp(want) != 0 {
+		t.Fatalf("root after reload is %s, want %s", reloaded.GetRoot(), want)
+	}
+	for _, root := range roots {
+		if root != nil && !reloaded.IsKnownRoot(root) {
+			t.Fatalf("root %s was lost by the reload", root)
+		}
+	}
+}
+
+// TestBatchInsertMatchesQuickInsert inserts the same leaves in random batches
+// and one by one, every batch must end on the root of the single inserts and
+// leave the same nodes behind. Batches of more than 2*minParallelPairs leaves
+// hash their lowest level on several goroutines
+func TestBatchInsertMatchesQuickInsert(t *testing.T) {
+	const levels = 8
+	rnd := rand.New(rand.NewSource(3))
+	for run := 0; run < 5; run++ {
+		leaves := randomLeaves(rnd, 1+rnd.Intn(1<<levels))
+		quick, err := NewZkTreeWithStore(levels, MemStore{}, Poseidon{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		batched, err := NewZkTreeWithStore(levels, MemStore{}, Poseidon{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for done := 0; done < len(leaves); {
+			n := 1 + rnd.Intn(len(leaves)-done)
+			first, err := batched.BatchInsert(leaves[done : done+n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first != done {
+				t.Fatalf("batch starts at %d, want %d", first, done)
+			}
+			for _, leaf := range leaves[done : done+n] {
+				_, err = quick.QuickInsert(leaf)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			done += n
+			if batched.GetRoot().Cmp(quick.GetRoot()) != 0 {
+				t.Fatalf("run %d: root after %d leaves differs", run, done)
+			}
+		}
+		for i := range leaves {
+			batchPath, _, err := batched.Path(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			quickPath, _, err := quick.Path(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for level := 0; level < levels; level++ {
+				if batchPath[level].Cmp(quickPath[level]) != 0 {
+					t.Fatalf("run %d: leaf %d has another sibling at level %d", run, i, level)
+				}
+			}
+		}
+	}
+}
+
+// benchmarkInsert fills a tree of depth 20 with 1024 leaves per iteration
+func benchmarkInsert(b *testing.B, batch bool) {
+	leaves := randomLeaves(rand.New(rand.NewSource(4)), 1024)
+	for i := 0; i < b.N; i++ {
+		tree, err := NewZkTreeWithStore(20, MemStore{}, NewMimcSponge())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if batch {
+			_, err = tree.BatchInsert(leaves)
+			if err != nil {
+				b.Fatal(err)
+			}
+			continue
+		}
+		for _, leaf := range leaves {
+			_, err = tree.QuickInsert(leaf)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkQuickInsert(b *testing.B) { benchmarkInsert(b, false) }
+func BenchmarkBatchInsert(b *testing.B) { benchmarkInsert(b, true) }
+
+// TestZkTreeErrors checks that every failure of the tree wraps the sentinel
+// callers match it by
+func TestZkTreeErrors(t *testing.T) {
+	const levels = 2
+	full := func(t *testing.T) *ZkTree {
+		tree, err := NewZkTreeWithStore(levels, MemStore{}, Poseidon{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tree.BatchInsert(randomLeaves(rand.New(rand.NewSource(5)), 1<<levels))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree
+	}
+	outOfField := new(big.Int).Add(FieldSize, big.NewInt(1))
+	cases := []struct {
+		name string
+		run  func(*ZkTree) error
+		want error
+	}{
+		{"insert into a full tree", func(tree *ZkTree) error {
+			_, err := tree.QuickInsert(big.NewInt(1))
+			return err
+		}, ErrTreeFull},
+		{"batch past the capacity", func(tree *ZkTree) error {
+			_, err := tree.BatchInsert([]*big.Int{big.NewInt(1)})
+			return err
+		}, ErrTreeFull},
+		{"leaf past the size", func(tree *ZkTree) error {
+			_, err := tree.Leaf(1 << levels)
+			return err
+		}, ErrIndexOutOfRange},
+		{"negative leaf index", func(tree *ZkTree) error {
+			_, err := tree.Leaf(-1)
+			return err
+		}, ErrIndexOutOfRange},
+		{"path past the size", func(tree *ZkTree) error {
+			_, _, err := tree.Path(1 << levels)
+			return err
+		}, ErrIndexOutOfRange},
+		{"revoke past the size", func(tree *ZkTree) error {
+			return tree.Revoke(1 << levels)
+		}, ErrIndexOutOfRange},
+		{"unknown element", func(tree *ZkTree) error {
+			_, err := tree.IndexOf(big.NewInt(1))
+			return err
+		}, ErrElementNotFound},
+		{"leaf outside the field", func(tree *ZkTree) error {
+			return tree.CheckLeaf(outOfField)
+		}, ErrHashFailed},
+		{"hash outside the field", func(tree *ZkTree) error {
+			_, err := tree.hash(outOfField, big.NewInt(1))
+			return err
+		}, ErrHashFailed},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.run(full(t))
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+// TestZkTreeRevoke replaces one leaf with Tombstone. The root must be that of
+// the tree with the tombstone, every other leaf keeps its index and a path to
+// the new root, and no root from before the revoke is known any more
+func TestZkTreeRevoke(t *testing.T) {
+	const levels = 4
+	leaves := randomLeaves(rand.New(rand.NewSource(9)), 11)
+	tree, err := NewZkTreeWithStore(levels, MemStore{}, Poseidon{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before []*big.Int
+	for _, leaf := range leaves {
+		_, err = tree.QuickInsert(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before = append(before, tree.GetRoot())
+	}
+
+	err = tree.Revoke(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked := append([]*big.Int(nil), leaves...)
+	revoked[5] = Tombstone
+	root := tree.GetRoot()
+	if want := fullRoot(t, Poseidon{}, levels, revoked); root.Cmp(want) != 0 {
+		t.Fatalf("root after revoke is %s, want %s", root, want)
+	}
+	for _, old := range before {
+		if tree.IsKnownRoot(old) {
+			t.Fatalf("root %s from before the revoke is still known", old)
+		}
+	}
+	if !tree.IsKnownRoot(root) {
+		t.Fatal("root after the revoke is not known")
+	}
+	for i, leaf := range revoked {
+		elements, indices, err := tree.Path(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tree.checkMerkleProof(elements, indices, leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Cmp(root) != 0 {
+			t.Fatalf("leaf %d has no path to the root after the revoke", i)
+		}
+	}
+	if _, err := tree.IndexOf(leaves[5]); !errors.Is(err, ErrElementNotFound) {
+		t.Fatalf("revoked leaf: got %v, want %v", err, ErrElementNotFound)
+	}
+	if err := tree.Revoke(5); err == nil {
+		t.Fatal("leaf revoked twice")
+	}
+
+	// the tree carries on from the new root
+	_, err = tree.QuickInsert(leaves[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fullRoot(t, Poseidon{}, levels, append(revoked, leaves[0])); tree.GetRoot().Cmp(want) != 0 {
+		t.Fatal("insert after the revoke gives another root")
+	}
+}
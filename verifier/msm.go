@@ -0,0 +1,152 @@
+package verifier
+
+import (
+	"math/big"
+	"math/bits"
+
+	"github.com/ethereum/go-ethereum/crypto/bn256"
+)
+
+// msmGroup is the group arithmetic Pippenger's method needs
+type msmGroup[P any] interface {
+	zero() P
+	add(a, b P) P
+	double(a P) P
+	mul(p P, s *big.Int) P
+}
+
+// Below these numbers of terms a scalar multiplication per term is faster
+// than Pippenger's method, whose windows cost about 2^(c+1) additions each
+// however few points they sort. Measured with the benchmarks in msm_test.go:
+// the big.Int code is even at 4 terms, bn256 still wins at 32 and is even at
+// 48. So D (7 terms) and F (9) of one proof go per term on bn256 only, the
+// opening check of a batch of proofs reaches Pippenger on both
+const (
+	msmMinTerms      = 5
+	msmMinTermsBN256 = 48
+)
+
+// multiScalarMul computes sum scalars[i] * points[i], with one scalar
+// multiplication per term below minTerms and Pippenger's method from there.
+// scalars must be in [0, r)
+func multiScalarMul[P any](g msmGroup[P], points []P, scalars []*big.Int, minTerms int) P {
+	if len(points) >= minTerms {
+		return pippenger(g, points, scalars)
+	}
+	sum := g.zero()
+	for i, p := range points {
+		sum = g.add(sum, g.mul(p, scalars[i]))
+	}
+	return sum
+}
+
+// msmWindow is the window size in bits for n terms, about ln(n) + 2
+func msmWindow(n int) int {
+	if n < 32 {
+		return 3
+	}
+	return bits.Len(uint(n))*69/100 + 2
+}
+
+// pippenger computes sum scalars[i] * points[i] with the bucket method. Each
+// c-bit window of the scalars sorts the points into 2^c - 1 buckets, which
+// costs about n + 2^(c+1) additions per window instead of n scalar
+// multiplications overall. scalars must be in [0, r)
+func pippenger[P any](g msmGroup[P], points []P, scalars []*big.Int) P {
+	maxBits := 0
+	for _, s := range scalars {
+		if s.BitLen() > maxBits {
+			maxBits = s.BitLen()
+		}
+	}
+	c := msmWindow(len(points))
+	windows := (maxBits + c - 1) / c
+	buckets := make([]P, 1<<c)
+
+	res := g.zero()
+	for w := windows - 1; w >= 0; w-- {
+		for i := 0; i < c; i++ {
+			res = g.double(res)
+		}
+		for j := range buckets {
+			buckets[j] = g.zero()
+		}
+		for i, s := range scalars {
+			digit := 0
+			for b := c - 1; b >= 0; b-- {
+				digit = digit<<1 | int(s.Bit(w*c+b))
+			}
+			if digit != 0 {
+				buckets[digit] = g.add(buckets[digit], points[i])
+			}
+		}
+		// sum_j j * bucket[j] as a running sum from the top bucket down
+		sum, acc := g.zero(), g.zero()
+		for j := len(buckets) - 1; j > 0; j-- {
+			sum = g.add(sum, buckets[j])
+			acc = g.add(acc, sum)
+		}
+		res = g.add(res, acc)
+	}
+	return res
+}
+
+// reduceScalars returns the scalars in [0, r), G1 has order r so the sum is
+// unchanged
+func reduceScalars(scalars []*big.Int) []*big.Int {
+	r := bn128Curve().R
+	reduced := make([]*big.Int, len(scalars))
+	for i, s := range scalars {
+		if s.Sign() < 0 || s.Cmp(r) >= 0 {
+			s = new(big.Int).Mod(s, r)
+		}
+		reduced[i] = s
+	}
+	return reduced
+}
+
+type bigIntG1 struct {
+	g1 G1
+}
+
+func (g bigIntG1) zero() [3]*big.Int {
+	return [3]*big.Int{g.g1.F.Zero(), g.g1.F.One(), g.g1.F.Zero()}
+}
+func (g bigIntG1) add(a, b [3]*big.Int) [3]*big.Int { return g.g1.Add(a, b) }
+func (g bigIntG1) double(a [3]*big.Int) [3]*big.Int { return g.g1.Double(a) }
+func (g bigIntG1) mul(p [3]*big.Int, s *big.Int) [3]*big.Int {
+	return g.g1.MulScalar(p, s)
+}
+
+// MultiScalarMul computes sum scalars[i] * points[i] on the big.Int G1 code
+func MultiScalarMul(points []G1, scalars []*big.Int) G1 {
+	curve := bn128Curve()
+	ps := make([][3]*big.Int, len(points))
+	for i, p := range points {
+		ps[i] = p.G
+	}
+	return G1{curve.Fq1, multiScalarMul[[3]*big.Int](bigIntG1{curve.G1}, ps, reduceScalars(scalars), msmMinTerms)}
+}
+
+type bn256G1 struct{}
+
+// zero unmarshals the point at infinity, ScalarBaseMult(0) would run a full
+// scalar multiplication for every bucket
+func (bn256G1) zero() *bn256.G1 {
+	g := new(bn256.G1)
+	_, err := g.Unmarshal(make([]byte, 64))
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+func (bn256G1) add(a, b *bn256.G1) *bn256.G1 { return new(bn256.G1).Add(a, b) }
+func (bn256G1) double(a *bn256.G1) *bn256.G1 { return new(bn256.G1).Add(a, a) }
+func (bn256G1) mul(p *bn256.G1, s *big.Int) *bn256.G1 {
+	return new(bn256.G1).ScalarMult(p, s)
+}
+
+// MultiScalarMulBN256 computes sum scalars[i] * points[i] on bn256
+func MultiScalarMulBN256(points []*bn256.G1, scalars []*big.Int) *bn256.G1 {
+	return multiScalarMul[*bn256.G1](bn256G1{}, points, reduceScalars(scalars), msmMinTermsBN256)
+}
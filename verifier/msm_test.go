@@ -0,0 +1,176 @@
+package verifier
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto/bn256"
+)
+
+// msmInputs returns n multiples of the generator, with repeated points, and
+// scalars that include zero, negative numbers and numbers above r
+func msmInputs(rnd *rand.Rand, n int) ([]G1, []*big.Int) {
+	curve := bn128Curve()
+	points := make([]G1, n)
+	scalars := make([]*big.Int, n)
+	for i := range points {
+		if i > 0 && i%4 == 0 {
+			points[i] = points[i-1]
+		} else {
+			k := new(big.Int).Rand(rnd, curve.R)
+			points[i] = G1{curve.Fq1, curve.G1.MulScalar(curve.G1.G, k)}
+		}
+		switch i % 5 {
+		case 1:
+			scalars[i] = new(big.Int)
+		case 2:
+			scalars[i] = new(big.Int).Neg(new(big.Int).Rand(rnd, curve.R))
+		case 3:
+			scalars[i] = new(big.Int).Add(curve.R, big.NewInt(rnd.Int63()))
+		default:
+			scalars[i] = new(big.Int).Rand(rnd, curve.R)
+		}
+	}
+	return points, scalars
+}
+
+// naiveSum adds up MulScalar of every term
+func naiveSum(points []G1, scalars []*big.Int) [3]*big.Int {
+	curve := bn128Curve()
+	sum := [3]*big.Int{curve.Fq1.Zero(), curve.Fq1.One(), curve.Fq1.Zero()}
+	for i, p := range points {
+		sum = curve.G1.Add(sum, curve.G1.MulScalar(p.G, new(big.Int).Mod(scalars[i], curve.R)))
+	}
+	return sum
+}
+
+// naiveSumBN256 adds up ScalarMult of every term
+func naiveSumBN256(points []*bn256.G1, scalars []*big.Int) *bn256.G1 {
+	r := bn128Curve().R
+	sum := new(bn256.G1).ScalarBaseMult(new(big.Int))
+	for i, p := range points {
+		sum = new(bn256.G1).Add(sum, new(bn256.G1).ScalarMult(p, new(big.Int).Mod(scalars[i], r)))
+	}
+	return sum
+}
+
+func toBN256Points(t testing.TB, points []G1) []*bn256.G1 {
+	converted := make([]*bn256.G1, len(points))
+	for i, p := range points {
+		var err error
+		converted[i], err = toBN256G1(p.G)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return converted
+}
+
+func TestMultiScalarMul(t *testing.T) {
+	g1 := bn128Curve().G1
+	rnd := rand.New(rand.NewSource(7))
+	// the window grows with the number of terms, the smallest sizes are summed
+	// per term
+	for _, n := range []int{0, 1, 2, 7, 40, 130} {
+		points, scalars := msmInputs(rnd, n)
+		want := naiveSum(points, scalars)
+		got := MultiScalarMul(points, scalars)
+		if !g1.Equal(got.G, want) {
+			t.Errorf("%d terms: big.Int sum differs from the naive sum", n)
+		}
+		bnPoints := toBN256Points(t, points)
+		gotBN256 := MultiScalarMulBN256(bnPoints, scalars)
+		if !bytes.Equal(gotBN256.Marshal(), naiveSumBN256(bnPoints, scalars).Marshal()) {
+			t.Errorf("%d terms: bn256 sum differs from the naive sum", n)
+		}
+		if !g1.Equal(fromBN256G1(gotBN256).G, want) {
+			t.Errorf("%d terms: bn256 and big.Int sums differ", n)
+		}
+		// both ways of summing run at every size, whatever the thresholds
+		if !bytes.Equal(pippenger[*bn256.G1](bn256G1{}, bnPoints, reduceScalars(scalars)).Marshal(), gotBN256.Marshal()) {
+			t.Errorf("%d terms: bn256 Pippenger sum differs", n)
+		}
+		perTerm := multiScalarMul[*bn256.G1](bn256G1{}, bnPoints, reduceScalars(scalars), n+1)
+		if !bytes.Equal(perTerm.Marshal(), gotBN256.Marshal()) {
+			t.Errorf("%d terms: bn256 per-term sum differs", n)
+		}
+	}
+}
+
+// TestG1AddSamePoint adds a point to itself and to its negation, given in
+// other Jacobian coordinates so Add can not tell them apart by equality of
+// the inputs
+func TestG1AddSamePoint(t *testing.T) {
+	curve := bn128Curve()
+	g1, fq := curve.G1, curve.Fq1
+	p := g1.MulScalar(g1.G, big.NewInt(12345))
+	lambda := big.NewInt(987654321)
+	lambda2 := fq.Square(lambda)
+	same := [3]*big.Int{fq.Mul(p[0], lambda2), fq.Mul(p[1], fq.Mul(lambda2, lambda)), fq.Mul(p[2], lambda)}
+	if !g1.Equal(p, same) {
+		t.Fatal("rescaled point is another point")
+	}
+	if sum := g1.Add(p, same); !g1.Equal(sum, g1.Double(p)) || g1.IsZero(sum) {
+		t.Error("p + p is not 2p")
+	}
+	if sum := g1.Add(p, g1.Neg(same)); !g1.IsZero(sum) {
+		t.Error("p + -p is not zero")
+	}
+	if sum := g1.Add(g1.Add(p, g1.Neg(p)), p); !g1.Equal(sum, p) {
+		t.Error("zero + p is not p")
+	}
+}
+
+// benchmarkTerms are the sizes the verifier sums: E has 1 term, the opening
+// check 2 and 4, vk_x of a groth16 key 5, D 7 and F 9. A batch of k proofs
+// opens 2k and 4k terms
+var benchmarkTerms = []int{1, 2, 4, 5, 7, 9, 16, 32, 48, 64, 256}
+
+// benchmarkSizes runs f for every size in benchmarkTerms
+func benchmarkSizes(b *testing.B, f func(b *testing.B, points []G1, scalars []*big.Int)) {
+	for _, n := range benchmarkTerms {
+		points, scalars := msmInputs(rand.New(rand.NewSource(8)), n)
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			f(b, points, scalars)
+		})
+	}
+}
+
+func BenchmarkMultiScalarMul(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, points []G1, scalars []*big.Int) {
+		for i := 0; i < b.N; i++ {
+			MultiScalarMul(points, scalars)
+		}
+	})
+}
+
+func BenchmarkMulScalarPerTerm(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, points []G1, scalars []*big.Int) {
+		for i := 0; i < b.N; i++ {
+			naiveSum(points, scalars)
+		}
+	})
+}
+
+func BenchmarkMultiScalarMulBN256(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, points []G1, scalars []*big.Int) {
+		bnPoints := toBN256Points(b, points)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			MultiScalarMulBN256(bnPoints, scalars)
+		}
+	})
+}
+
+func BenchmarkScalarMultPerTermBN256(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, points []G1, scalars []*big.Int) {
+		bnPoints := toBN256Points(b, points)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			naiveSumBN256(bnPoints, scalars)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package verifier
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto/bn256"
+)
+
+// PreparedVk is the part of a PLONK verification that only depends on the
+// key. ParseVk builds it once, every proof checked against the key reuses it
+type PreparedVk struct {
+	// Omega generates the evaluation domain of size N = 2^Power
+	Omega *big.Int
+	N     *big.Int
+	// NInv is 1/N in Fr
+	NInv *big.Int
+	// x2 is X2 for the bn256 backend, which has no API for line coefficients
+	x2 *bn256.G2
+
+	// the Miller loop line coefficients of X2 and the G2 generator for the
+	// big.Int backend, built by the first proof checked on it. BackendBN256
+	// never needs them
+	x2Point      [3][2]*big.Int
+	linesOnce    sync.Once
+	x2Pre, g2Pre AteG2Precomp
+}
+
+// NewPreparedVk computes the prepared key of vk, it fails if X2 is not on
+// the curve
+func NewPreparedVk(vk *Vk) (*PreparedVk, error) {
+	x2, err := toBN256G2(vk.X2.G)
+	if err != nil {
+		return nil, err
+	}
+	return prepare(vk, x2), nil
+}
+
+func prepare(vk *Vk, x2 *bn256.G2) *PreparedVk {
+	curve := bn128Curve()
+	n := new(big.Int).Lsh(big.NewInt(1), uint(vk.Power))
+	return &PreparedVk{
+		Omega:   rootsOfUnity()[vk.Power],
+		N:       n,
+		NInv:    NewFq(curve.R).Inverse(n),
+		x2:      x2,
+		x2Point: vk.X2.G,
+	}
+}
+
+// lines returns the line coefficients of X2 and the G2 generator
+func (pvk *PreparedVk) lines() (x2Pre, g2Pre AteG2Precomp) {
+	pvk.linesOnce.Do(func() {
+		pvk.x2Pre = bn128Curve().preComputeG2(pvk.x2Point)
+		pvk.g2Pre = g2GeneratorPrecomp()
+	})
+	return pvk.x2Pre, pvk.g2Pre
+}
+
+// prepared returns vk.Prepared, a Vk that was not built by ParseVk gets a
+// fresh one on every call
+func (vk *Vk) prepared() *PreparedVk {
+	if vk.Prepared != nil {
+		return vk.Prepared
+	}
+	// x2 stays nil if X2 is off the curve, the bn256 check then fails
+	x2, _ := toBN256G2(vk.X2.G)
+	return prepare(vk, x2)
+}
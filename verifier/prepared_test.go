@@ -0,0 +1,56 @@
+package verifier
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestPreparedVk(t *testing.T) {
+	vk, _, _ := loadPlonk(t)
+	pvk := vk.Prepared
+	Fr := NewFq(bn128Curve().R)
+
+	if n := new(big.Int).Lsh(big.NewInt(1), uint(vk.Power)); pvk.N.Cmp(n) != 0 {
+		t.Fatalf("N is %v, want 2^%d", pvk.N, vk.Power)
+	}
+	if omega := calculateSW(Fr.Q, big.NewInt(1), big.NewInt(2), Fr)[vk.Power]; pvk.Omega.Cmp(omega) != 0 {
+		t.Fatal("Omega is not the root of unity of the domain")
+	}
+	half := new(big.Int).Rsh(pvk.N, 1)
+	if Fr.Exp(pvk.Omega, pvk.N).Cmp(big.NewInt(1)) != 0 || Fr.Exp(pvk.Omega, half).Cmp(big.NewInt(1)) == 0 {
+		t.Fatal("Omega does not have order N")
+	}
+	if Fr.Mul(pvk.NInv, pvk.N).Cmp(big.NewInt(1)) != 0 {
+		t.Fatal("NInv is not the inverse of N")
+	}
+}
+
+// TestPreparedVkVerify checks a key with and without its prepared part on
+// both backends, only the big.Int backend builds the line coefficients
+func TestPreparedVkVerify(t *testing.T) {
+	vk, proof, public := loadPlonk(t)
+	forged := []*big.Int{public[0], new(big.Int).Add(public[1], big.NewInt(1))}
+	bare := *vk
+	bare.Prepared = nil
+
+	withBackend(BackendBN256, func() {
+		for _, k := range []*Vk{vk, &bare} {
+			if !k.Verify(proof, public) || k.Verify(proof, forged) {
+				t.Errorf("bn256, prepared %v: wrong result", k.Prepared != nil)
+			}
+		}
+	})
+	if vk.Prepared.x2Pre.Coeffs != nil {
+		t.Fatal("the bn256 backend built the line coefficients")
+	}
+	withBackend(BackendBigInt, func() {
+		for _, k := range []*Vk{vk, &bare} {
+			if !k.Verify(proof, public) || k.Verify(proof, forged) {
+				t.Errorf("big.Int, prepared %v: wrong result", k.Prepared != nil)
+			}
+		}
+	})
+	if vk.Prepared.x2Pre.Coeffs == nil {
+		t.Fatal("the big.Int backend did not keep the line coefficients")
+	}
+}
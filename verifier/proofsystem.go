@@ -0,0 +1,145 @@
+package verifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Protocols of snarkjs with a verifier in this package
+const (
+	ProtocolPlonk   = "plonk"
+	ProtocolGroth16 = "groth16"
+)
+
+// ErrWrongProtocol is returned for a proof of another protocol than its key
+var ErrWrongProtocol = errors.New("proof is for another protocol")
+
+// ProofSystem is one zk-SNARK protocol, it reads the verification keys
+// snarkjs exports for it
+type ProofSystem interface {
+	Protocol() string
+	ParseVk(vj []byte) (VerifyingKey, error)
+}
+
+// VerifyingKey checks the proofs of one circuit
+type VerifyingKey interface {
+	Protocol() string
+	// PublicInputs is the number of public signals of a proof
+	PublicInputs() int
+	// TreeLevels is the voter tree depth the circuit was built for, 0 if unknown
+	TreeLevels() int
+	// SignalNames is the "signals" list of the key, nil if it has none
+	SignalNames() []string
+	// ParseProof reads a snarkjs proof.json made for this key
+	ParseProof(pj []byte) (ZkProof, error)
+	Verify(proof ZkProof, public []*big.Int) bool
+}
+
+// ZkProof is a parsed proof of one protocol
+type ZkProof interface {
+	Protocol() string
+}
+
+var proofSystems = map[string]ProofSystem{
+	ProtocolPlonk:   plonk{},
+	ProtocolGroth16: groth16{},
+}
+
+// NewProofSystem returns the proof system of protocol, PLONK if it is empty
+func NewProofSystem(protocol string) (ProofSystem, error) {
+	if protocol == "" {
+		protocol = ProtocolPlonk
+	}
+	ps, ok := proofSystems[protocol]
+	if !ok {
+		return nil, fmt.Errorf("unsupported protocol %q", protocol)
+	}
+	return ps, nil
+}
+
+// ParseVerifyingKey reads a verification_key.json of any supported protocol
+func ParseVerifyingKey(vj []byte) (VerifyingKey, error) {
+	protocol, err := protocolOf(vj)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := NewProofSystem(protocol)
+	if err != nil {
+		return nil, err
+	}
+	return ps.ParseVk(vj)
+}
+
+// protocolOf reads the protocol field snarkjs writes in keys and proofs
+func protocolOf(bz []byte) (string, error) {
+	var header struct {
+		Protocol string `json:"protocol"`
+	}
+	err := json.Unmarshal(bz, &header)
+	return header.Protocol, err
+}
+
+// checkProtocol rejects a proof whose protocol field names another protocol
+func checkProtocol(pj []byte, protocol string) error {
+	p, err := protocolOf(pj)
+	if err != nil {
+		return err
+	}
+	if p != "" && p != protocol {
+		return fmt.Errorf("%w: %s proof for a %s key", ErrWrongProtocol, p, protocol)
+	}
+	return nil
+}
+
+// VerifyAll reports which proofs of one key are valid, PLONK proofs are
+// checked in one batch
+func VerifyAll(vk VerifyingKey, proofs []ZkProof, publics [][]*big.Int) []bool {
+	if pvk, ok := vk.(*Vk); ok {
+		plonkProofs := make([]*Proof, len(proofs))
+		for i, proof := range proofs {
+			// a proof of another protocol stays nil and is invalid
+			plonkProofs[i], _ = proof.(*Proof)
+		}
+		return BatchVerify(plonkProofs, publics, pvk)
+	}
+	valid := make([]bool, len(proofs))
+	for i, proof := range proofs {
+		valid[i] = vk.Verify(proof, publics[i])
+	}
+	return valid
+}
+
+type plonk struct{}
+
+func (plonk) Protocol() string { return ProtocolPlonk }
+
+func (plonk) ParseVk(vj []byte) (VerifyingKey, error) {
+	return ParseVk(vj)
+}
+
+func (vk *Vk) Protocol() string      { return ProtocolPlonk }
+func (vk *Vk) PublicInputs() int     { return vk.NPublic }
+func (vk *Vk) TreeLevels() int       { return vk.Levels }
+func (vk *Vk) SignalNames() []string { return vk.Signals }
+
+func (vk *Vk) ParseProof(pj []byte) (ZkProof, error) {
+	err := checkProtocol(pj, ProtocolPlonk)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProof(pj)
+}
+
+// Verify checks one PLONK proof, public must hold exactly NPublic signals
+// since the public input polynomial is evaluated over all of them
+func (vk *Vk) Verify(proof ZkProof, public []*big.Int) bool {
+	p, ok := proof.(*Proof)
+	if !ok || len(public) != vk.NPublic {
+		return false
+	}
+	return NewVerifier(vk, p, public).Verify()
+}
+
+func (proof *Proof) Protocol() string { return ProtocolPlonk }
@@ -3,6 +3,8 @@ package verifier
 import (
 
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
 	"strconv"
 	"encoding/binary"
@@ -54,7 +56,7 @@ func (fq *Fq) ToRprBE(buff []byte, o int, num *big.Int) {
 }
 
 func calculateChallenges(proof *Proof, publicSignals []*big.Int) map[string]*big.Int {
-	curve ,_:= NewBn128()
+	curve := bn128Curve()
 	G1 := curve.G1
 	Fr := NewFq(curve.R)
 	n8r:= 32
@@ -140,6 +142,8 @@ type VkString struct {
 	S3       []string `json:"S3"`
 	X2       [][]string `json:"X_2"`
 	W        string   `json:"w"`
+	Levels   int      `json:"levels,omitempty"` // depth of the voter tree the circuit was built for, not part of snarkjs' output
+	Signals  []string `json:"signals,omitempty"` // name of each public signal, not part of snarkjs' output
 }
 
 type ProofString struct {
@@ -185,6 +189,8 @@ type Proof struct {
 
 type Vk struct {
 	NPublic  int 
+	Levels   int 
+	Signals  []string
 	Power    int      
 	K1       int
 	K2       int
@@ -198,6 +204,7 @@ type Vk struct {
 	S3       G1
 	X2       G2
 	W        *big.Int
+	Prepared *PreparedVk // built by ParseVk, shared by every proof of the key
 }
 
 type Verifier struct {
@@ -211,6 +218,8 @@ type Verifier struct {
 	D G1
 	F G1
 	E G1
+	backend Backend
+	err error // a point the backend could not take, the proof is invalid
 }
 
 func ParseVk(vj []byte) (*Vk, error) {
@@ -232,22 +241,56 @@ func ParseProof(pj []byte) (*Proof, error) {
 	return p, err
 }
 
-func ParsePub(dat []byte) ([]*big.Int,error) {
+// ParsePub reads the public signals of a proof, there must be exactly
+// nPublic of them as declared by the verification key. Every signal must be
+// in [0, r): the verifier reduces them mod r, so n and n+r would pass as two
+// different nullifiers
+func ParsePub(dat []byte, nPublic int) ([]*big.Int,error) {
 	var pub []string
 	err := json.Unmarshal(dat, &pub)
-	temp0, _:=new(big.Int).SetString(pub[0],10)
-	temp1, _:=new(big.Int).SetString(pub[1],10)
-	pub1 := []*big.Int{
-		temp0,
-		temp1,
+	if err != nil {
+		return nil, err
 	}
-	
-	return pub1 , err
+	if len(pub) != nPublic {
+		return nil, fmt.Errorf("expected %d public signals, got %d", nPublic, len(pub))
+	}
+	pub1 := make([]*big.Int, len(pub))
+	for i, sig := range pub {
+		temp, ok := new(big.Int).SetString(sig,10)
+		if !ok {
+			return nil, errors.New("invalid public signal")
+		}
+		if temp.Sign() < 0 || temp.Cmp(bn128Curve().R) >= 0 {
+			return nil, errors.New("public signal is not in the scalar field")
+		}
+		pub1[i] = temp
+	}
+	return pub1 , nil
+}
+
+// checkPoints makes sure every point has both affine coordinates, as
+// numbers, before they are indexed
+func checkPoints(points ...[]string) error {
+	for _, p := range points {
+		if len(p) < 2 {
+			return errors.New("invalid curve point")
+		}
+		for _, c := range p[:2] {
+			if _, ok := new(big.Int).SetString(c, 10); !ok {
+				return errors.New("invalid curve point")
+			}
+		}
+	}
+	return nil
 }
 
 func ProofStringToProof(pr ProofString) (*Proof,error) {
 	var err error
-	BN128, err := NewBn128()
+	err = checkPoints(pr.A, pr.B, pr.C, pr.Z, pr.T1, pr.T2, pr.T3, pr.Wxi, pr.Wxiw)
+	if err != nil {
+		return nil, err
+	}
+	BN128 := bn128Curve()
 	var p Proof
 	p.A = StringToG1(BN128.Fq1,pr.A[0],pr.A[1])
 	p.B = StringToG1(BN128.Fq1,pr.B[0],pr.B[1])
@@ -258,30 +301,49 @@ func ProofStringToProof(pr ProofString) (*Proof,error) {
 	p.T3 = StringToG1(BN128.Fq1,pr.T3[0],pr.T3[1])
 	p.Wxi = StringToG1(BN128.Fq1,pr.Wxi[0],pr.Wxi[1])
 	p.Wxiw = StringToG1(BN128.Fq1,pr.Wxiw[0],pr.Wxiw[1])
-	temp , _ := new(big.Int).SetString(pr.EvalA,10)
-	p.EvalA = temp
-	temp1 , _ := new(big.Int).SetString(pr.EvalB,10)
-	p.EvalB = temp1
-	temp2 , _ := new(big.Int).SetString(pr.EvalC,10)
-	p.EvalC = temp2
-	temp3 , _ := new(big.Int).SetString(pr.EvalR,10)
-	p.EvalR = temp3
-	temp4 , _ := new(big.Int).SetString(pr.EvalS1,10)
-	p.EvalS1 = temp4
-	temp5 , _ := new(big.Int).SetString(pr.EvalS2,10)
-	p.EvalS2 = temp5
-	temp6 , _ := new(big.Int).SetString(pr.EvalZW,10)
-	p.EvalZW = temp6
+	// every evaluation must be a number, a nil one would panic in the verifier
+	evals := []struct{
+		dst **big.Int
+		s string
+	}{
+		{&p.EvalA, pr.EvalA},
+		{&p.EvalB, pr.EvalB},
+		{&p.EvalC, pr.EvalC},
+		{&p.EvalR, pr.EvalR},
+		{&p.EvalS1, pr.EvalS1},
+		{&p.EvalS2, pr.EvalS2},
+		{&p.EvalZW, pr.EvalZW},
+	}
+	for _, ev := range evals {
+		temp, ok := new(big.Int).SetString(ev.s,10)
+		if !ok {
+			return nil, errors.New("invalid proof evaluation")
+		}
+		*ev.dst = temp
+	}
 	return &p, err
 }
 
 func vkStringToVk(vr VkString) (*Vk, error) {
 	var err error
-	BN128, err := NewBn128()
+	err = checkPoints(vr.Qm, vr.Ql, vr.Qr, vr.Qo, vr.Qc, vr.S1, vr.S2, vr.S3)
+	if err != nil {
+		return nil, err
+	}
+	if len(vr.X2) < 2 || checkPoints(vr.X2[0], vr.X2[1]) != nil {
+		return nil, errors.New("invalid curve point")
+	}
+	BN128 := bn128Curve()
 	
 	var v Vk
 	v.NPublic = vr.NPublic
+	v.Levels = vr.Levels
+	v.Signals = vr.Signals
 	v.Power = vr.Power
+	// the bn128 scalar field has a 2-adic subgroup of order 2^28
+	if v.Power <= 0 || v.Power > 28 {
+		return nil, errors.New("invalid domain power")
+	}
 	
 	temp , err := strconv.Atoi(vr.K1)
 	v.K1 = temp
@@ -307,7 +369,11 @@ func vkStringToVk(vr VkString) (*Vk, error) {
 	
 	temppp , _ := new(big.Int).SetString(vr.W,10)
 	v.W = temppp
-	return &v, err
+	v.Prepared, err = NewPreparedVk(&v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
 
 }
 
@@ -383,33 +449,30 @@ func calculateSW(p *big.Int, one *big.Int, nqr *big.Int,Fr Fq) []*big.Int {
 }
 
 func calculateLagrangeEvaluations( challenges map[string]*big.Int, vk *Vk) []*big.Int {
-	curve,_ := NewBn128()
+	curve := bn128Curve()
 	Fr := NewFq(curve.R)
 
+	pvk := vk.prepared()
+
 	xin,_ := challenges["xi"]
 	
-	domainSize := big.NewInt(1)
-
 	for i := 0; i < vk.Power; i++ {
 		xin = Fr.Square(xin)
-		domainSize.Mul(domainSize, big.NewInt(2))
 	}
 	challenges["xin"] = xin
 
 	challenges["zh"] = Fr.Sub(xin, big.NewInt(1))
 	L := make([]*big.Int, vk.NPublic+1)
 	
-	n := new(big.Int).Mod(domainSize,Fr.Q)
 	w := big.NewInt(1)
-	W := calculateSW(Fr.Q, big.NewInt(1),big.NewInt(2),Fr)
 	
 	
 	for i := 1; i <= max(1, vk.NPublic); i++ {
 		L[i] = Fr.Div(
-			Fr.Mul(w, challenges["zh"]),
-			Fr.Mul(n, Fr.Sub(challenges["xi"], w)),
+			Fr.Mul(Fr.Mul(w, challenges["zh"]), pvk.NInv),
+			Fr.Sub(challenges["xi"], w),
 		)
-		w = Fr.Mul(w, W[vk.Power])
+		w = Fr.Mul(w, pvk.Omega)
 	}
 
 	return L
@@ -423,7 +486,7 @@ func max(a, b int) int {
 }
 
 func calculatePl(publicSignals []*big.Int, L []*big.Int) *big.Int {
-	curve,_ := NewBn128()
+	curve := bn128Curve()
 	Fr := NewFq(curve.R)
 
     pl := Fr.Zero()
@@ -436,7 +499,7 @@ func calculatePl(publicSignals []*big.Int, L []*big.Int) *big.Int {
 }
 
 func calculateT( proof *Proof, challenges  map[string]*big.Int, pl *big.Int, l1 *big.Int) *big.Int {
-	curve,_ := NewBn128()
+	curve := bn128Curve()
 	Fr := NewFq(curve.R)
 
 	
@@ -467,153 +530,193 @@ func calculateT( proof *Proof, challenges  map[string]*big.Int, pl *big.Int, l1
     return t
 }
 
-func calculateD( proof *Proof, challenges map[string]*big.Int, vk *Vk, l1 *big.Int) G1 {
-	curve,_ := NewBn128()
-	Fr := NewFq(curve.R)
-	var g1 G1
-	g1.F = curve.Fq1
-    s1 := Fr.Mul(Fr.Mul(proof.EvalA, proof.EvalB), challenges["v1"])
-	
-    res := g1.MulScalar(vk.Qm.G,s1)
-	
-    s2 := Fr.Mul(proof.EvalA, challenges["v1"])
-    res = g1.Add(res, g1.MulScalar(vk.Ql.G, s2))
-	
-    s3 := Fr.Mul(proof.EvalB, challenges["v1"])
-    res = g1.Add(res, g1.MulScalar(vk.Qr.G, s3))
-
-    s4 := Fr.Mul(proof.EvalC, challenges["v1"])
-    res = g1.Add(res, g1.MulScalar(vk.Qo.G, s4))
-
-    res = g1.Add(res, g1.MulScalar(vk.Qc.G, challenges["v1"]))
-
-    betaxi := Fr.Mul(challenges["beta"], challenges["xi"])
-    s6a := proof.EvalA
-    s6a = Fr.Add(s6a, betaxi)
-    s6a = Fr.Add(s6a, challenges["gamma"])
-
-    s6b := proof.EvalB
-    s6b = Fr.Add(s6b, Fr.Mul(betaxi, big.NewInt(int64(vk.K1))))
-    s6b = Fr.Add(s6b, challenges["gamma"])
-
-    s6c := proof.EvalC
-    s6c = Fr.Add(s6c, Fr.Mul(betaxi, big.NewInt(int64(vk.K2))))
-    s6c = Fr.Add(s6c, challenges["gamma"])
-
-    s6 := Fr.Mul(Fr.Mul(s6a, s6b), s6c)
-    s6 = Fr.Mul(s6, Fr.Mul(challenges["alpha"], challenges["v1"]))
+// g1Term is one point times scalar of a linear combination of G1 points, the
+// commitments of the verifier are built from these so every backend shares
+// the scalar arithmetic
+type g1Term struct {
+	p [3]*big.Int
+	s *big.Int
+}
 
-    s6d := Fr.Mul(Fr.Mul(l1, Fr.Square(challenges["alpha"])), challenges["v1"])
-    s6 = Fr.Add(s6, s6d)
+// sumTerms adds up the terms on the big.Int curve code with one
+// multi-scalar multiplication
+func sumTerms(g1 G1, terms []g1Term) [3]*big.Int {
+	points := make([][3]*big.Int, len(terms))
+	scalars := make([]*big.Int, len(terms))
+	for i, t := range terms {
+		points[i], scalars[i] = t.p, t.s
+	}
+	return multiScalarMul[[3]*big.Int](bigIntG1{g1}, points, reduceScalars(scalars), msmMinTerms)
+}
 
-    s6 = Fr.Add(s6, challenges["u"])
-    res = g1.Add(res, g1.MulScalar(proof.Z.G, s6))
-	
+// dTerms are the terms of the linearisation commitment D
+func dTerms(proof *Proof, challenges map[string]*big.Int, vk *Vk, l1 *big.Int) []g1Term {
+	curve := bn128Curve()
+	Fr := NewFq(curve.R)
+	s1 := Fr.Mul(Fr.Mul(proof.EvalA, proof.EvalB), challenges["v1"])
+	s2 := Fr.Mul(proof.EvalA, challenges["v1"])
+	s3 := Fr.Mul(proof.EvalB, challenges["v1"])
+	s4 := Fr.Mul(proof.EvalC, challenges["v1"])
+
+	betaxi := Fr.Mul(challenges["beta"], challenges["xi"])
+	s6a := proof.EvalA
+	s6a = Fr.Add(s6a, betaxi)
+	s6a = Fr.Add(s6a, challenges["gamma"])
+
+	s6b := proof.EvalB
+	s6b = Fr.Add(s6b, Fr.Mul(betaxi, big.NewInt(int64(vk.K1))))
+	s6b = Fr.Add(s6b, challenges["gamma"])
+
+	s6c := proof.EvalC
+	s6c = Fr.Add(s6c, Fr.Mul(betaxi, big.NewInt(int64(vk.K2))))
+	s6c = Fr.Add(s6c, challenges["gamma"])
+
+	s6 := Fr.Mul(Fr.Mul(s6a, s6b), s6c)
+	s6 = Fr.Mul(s6, Fr.Mul(challenges["alpha"], challenges["v1"]))
+
+	s6d := Fr.Mul(Fr.Mul(l1, Fr.Square(challenges["alpha"])), challenges["v1"])
+	s6 = Fr.Add(s6, s6d)
+
+	s6 = Fr.Add(s6, challenges["u"])
+
+	s7a := proof.EvalA
+	s7a = Fr.Add(s7a, Fr.Mul(challenges["beta"], proof.EvalS1))
+	s7a = Fr.Add(s7a, challenges["gamma"])
+
+	s7b := proof.EvalB
+	s7b = Fr.Add(s7b, Fr.Mul(challenges["beta"], proof.EvalS2))
+	s7b = Fr.Add(s7b, challenges["gamma"])
+
+	s7 := Fr.Mul(s7a, s7b)
+	s7 = Fr.Mul(s7, challenges["alpha"])
+	s7 = Fr.Mul(s7, challenges["v1"])
+	s7 = Fr.Mul(s7, challenges["beta"])
+	s7 = Fr.Mul(s7, proof.EvalZW)
+
+	return []g1Term{
+		{vk.Qm.G, s1},
+		{vk.Ql.G, s2},
+		{vk.Qr.G, s3},
+		{vk.Qo.G, s4},
+		{vk.Qc.G, challenges["v1"]},
+		{proof.Z.G, s6},
+		// D subtracts s7 * S3
+		{vk.S3.G, Fr.Neg(s7)},
+	}
+}
 
-    s7a := proof.EvalA
-    s7a = Fr.Add(s7a, Fr.Mul(challenges["beta"], proof.EvalS1))
-    s7a = Fr.Add(s7a, challenges["gamma"])
-
-    s7b := proof.EvalB
-    s7b = Fr.Add(s7b, Fr.Mul(challenges["beta"], proof.EvalS2))
-    s7b = Fr.Add(s7b, challenges["gamma"])
-
-    s7 := Fr.Mul(s7a, s7b)
-    s7 = Fr.Mul(s7, challenges["alpha"])
-    s7 = Fr.Mul(s7, challenges["v1"])
-    s7 = Fr.Mul(s7, challenges["beta"])
-    s7 = Fr.Mul(s7, proof.EvalZW)
-    res = g1.Sub(res, g1.MulScalar(vk.S3.G, s7))
-	res1 := G1{
+func calculateD( proof *Proof, challenges map[string]*big.Int, vk *Vk, l1 *big.Int) G1 {
+	curve := bn128Curve()
+	return G1{
 		curve.Fq1,
-		res,
+		sumTerms(curve.G1, dTerms(proof, challenges, vk, l1)),
 	}
-	// fmt.Println(g1.Affine(res))
-    return res1
 }
 
-func calculateF(proof *Proof, challenges map[string]*big.Int, vk *Vk, D G1) G1 {
-    curve,_ := NewBn128()
+// fTerms are the terms of the batched commitment F
+func fTerms(proof *Proof, challenges map[string]*big.Int, vk *Vk, D G1) []g1Term {
+	curve := bn128Curve()
 	Fr := NewFq(curve.R)
-	var g1 G1
-	g1.F = curve.Fq1
-    res := proof.T1.G
-
-    res = g1.Add(res, g1.MulScalar(proof.T2.G, challenges["xin"]))
-    res = g1.Add(res, g1.MulScalar(proof.T3.G, Fr.Square(challenges["xin"])))
-    res = g1.Add(res, D.G)
-    res = g1.Add(res, g1.MulScalar(proof.A.G, challenges["v2"]))
-    res = g1.Add(res, g1.MulScalar(proof.B.G, challenges["v3"]))
-    res = g1.Add(res, g1.MulScalar(proof.C.G, challenges["v4"]))
-    res = g1.Add(res, g1.MulScalar(vk.S1.G, challenges["v5"]))
-    res = g1.Add(res, g1.MulScalar(vk.S2.G, challenges["v6"]))
-	res1 := G1{
+	one := big.NewInt(1)
+	return []g1Term{
+		{proof.T1.G, one},
+		{proof.T2.G, challenges["xin"]},
+		{proof.T3.G, Fr.Square(challenges["xin"])},
+		{D.G, one},
+		{proof.A.G, challenges["v2"]},
+		{proof.B.G, challenges["v3"]},
+		{proof.C.G, challenges["v4"]},
+		{vk.S1.G, challenges["v5"]},
+		{vk.S2.G, challenges["v6"]},
+	}
+}
+
+func calculateF(proof *Proof, challenges map[string]*big.Int, vk *Vk, D G1) G1 {
+	curve := bn128Curve()
+	return G1{
 		curve.Fq1,
-		res,
+		sumTerms(curve.G1, fTerms(proof, challenges, vk, D)),
 	}
-	// fmt.Println(g1.Affine(res))
-    return res1
 }
 
-func calculateE(proof *Proof, challenges map[string]*big.Int, t *big.Int) G1 {
-	curve,_ := NewBn128()
+// eTerms are the terms of the group-encoded batch evaluation E
+func eTerms(proof *Proof, challenges map[string]*big.Int, t *big.Int) []g1Term {
+	curve := bn128Curve()
 	Fr := NewFq(curve.R)
-	var g1 G1
-	g1.F = curve.Fq1
 
-    s := new(big.Int).Set(t)
+	s := new(big.Int).Set(t)
+	s = Fr.Add(s, Fr.Mul(challenges["v1"], proof.EvalR))
+	s = Fr.Add(s, Fr.Mul(challenges["v2"], proof.EvalA))
+	s = Fr.Add(s, Fr.Mul(challenges["v3"], proof.EvalB))
+	s = Fr.Add(s, Fr.Mul(challenges["v4"], proof.EvalC))
+	s = Fr.Add(s, Fr.Mul(challenges["v5"], proof.EvalS1))
+	s = Fr.Add(s, Fr.Mul(challenges["v6"], proof.EvalS2))
+	s = Fr.Add(s, Fr.Mul(challenges["u"], proof.EvalZW))
 
-    s = Fr.Add(s, Fr.Mul(challenges["v1"], proof.EvalR))
-    s= Fr.Add(s, Fr.Mul(challenges["v2"], proof.EvalA))
-    s= Fr.Add(s, Fr.Mul(challenges["v3"], proof.EvalB))
-    s= Fr.Add(s, Fr.Mul(challenges["v4"], proof.EvalC))
-    s= Fr.Add(s, Fr.Mul(challenges["v5"], proof.EvalS1))
-    s= Fr.Add(s, Fr.Mul(challenges["v6"], proof.EvalS2))
-    s= Fr.Add(s, Fr.Mul(challenges["u"], proof.EvalZW))
+	return []g1Term{{curve.G1.G, s}}
+}
 
-    res := g1.MulScalar(curve.G1.G, s)
-	res1 := G1{
+func calculateE(proof *Proof, challenges map[string]*big.Int, t *big.Int) G1 {
+	curve := bn128Curve()
+	return G1{
 		curve.Fq1,
-		res,
+		sumTerms(curve.G1, eTerms(proof, challenges, t)),
 	}
-	
-	// fmt.Println(g1.Affine(res))
-    return res1
 }
 
-func verify(proof *Proof, challenges map[string]*big.Int,vk *Vk, E, F G1) (bool) {
-	curve,_ := NewBn128()
+// openingTerms are the terms of the points of the KZG opening check
+// e(A1, X2) = e(B1, G2)
+func openingTerms(proof *Proof, challenges map[string]*big.Int, vk *Vk, E, F G1) (a, b []g1Term) {
+	curve := bn128Curve()
 	Fr := NewFq(curve.R)
-	var g1 G1
-	g1.F = curve.Fq1
-	A1 := proof.Wxi.G
-	A1 = g1.Add(A1, g1.MulScalar(proof.Wxiw.G, challenges["u"]))
-
-	B1 := g1.MulScalar(proof.Wxi.G, challenges["xi"])
-	W := calculateSW(Fr.Q, big.NewInt(1),big.NewInt(2),Fr)
-	s := Fr.Mul(Fr.Mul(challenges["u"], challenges["xi"]), W[vk.Power])
-	B1 = g1.Add(B1, g1.MulScalar(proof.Wxiw.G, s))
-	B1 = g1.Add(B1,F.G)
-	B1 = g1.Add(B1,g1.Neg(E.G))
-	if !curve.Fq12.Equal(curve.Pairing(A1,vk.X2.G),curve.Pairing(B1,curve.G2.G)) {
-		
-		return false
+	one := big.NewInt(1)
+	s := Fr.Mul(Fr.Mul(challenges["u"], challenges["xi"]), vk.prepared().Omega)
+	a = []g1Term{
+		{proof.Wxi.G, one},
+		{proof.Wxiw.G, challenges["u"]},
 	}
-	
-	return true
+	b = []g1Term{
+		{proof.Wxi.G, challenges["xi"]},
+		{proof.Wxiw.G, s},
+		{F.G, one},
+		{E.G, Fr.Neg(one)},
+	}
+	return a, b
+}
+
+// opening returns the points of the KZG opening check e(A1, X2) = e(B1, G2)
+func opening(proof *Proof, challenges map[string]*big.Int,vk *Vk, E, F G1) (A1, B1 [3]*big.Int) {
+	curve := bn128Curve()
+	a, b := openingTerms(proof, challenges, vk, E, F)
+	return sumTerms(curve.G1, a), sumTerms(curve.G1, b)
+}
+
+func verify(proof *Proof, challenges map[string]*big.Int,vk *Vk, E, F G1) (bool) {
+	A1, B1 := opening(proof, challenges, vk, E, F)
+	return openingPairing(vk.prepared(), A1, B1)
 }
 
 func  NewVerifier(vk *Vk, proof *Proof, public []*big.Int) ( *Verifier) {
+	return NewVerifierWithBackend(vk, proof, public, DefaultBackend)
+}
+
+// NewVerifierWithBackend is NewVerifier with the curve arithmetic of backend,
+// every backend gives the same result
+func NewVerifierWithBackend(vk *Vk, proof *Proof, public []*big.Int, backend Backend) *Verifier {
 	verifier := &Verifier{
 		vk : vk,
 		proof : proof,
 		public : public,
-	
+		backend : backend,
 	}
 	verifier.challenges = calculateChallenges(verifier.proof,verifier.public)
 	verifier.EvalLarange = calculateLagrangeEvaluations(verifier.challenges,verifier.vk)
 	verifier.Pl = calculatePl(public, verifier.EvalLarange)
 	verifier.T = calculateT(verifier.proof,verifier.challenges,verifier.Pl,verifier.EvalLarange[1])
+	if backend == BackendBN256 {
+		verifier.err = linearizeBN256(verifier)
+		return verifier
+	}
 	verifier.D = calculateD(verifier.proof,verifier.challenges,verifier.vk,verifier.EvalLarange[1])
 	verifier.E = calculateE(verifier.proof,verifier.challenges,verifier.T)
 	verifier.F = calculateF(verifier.proof,verifier.challenges,verifier.vk,verifier.D)
@@ -621,6 +724,12 @@ func  NewVerifier(vk *Vk, proof *Proof, public []*big.Int) ( *Verifier) {
 }
 
 func (verifier *Verifier) Verify() (bool){
+	if verifier.err != nil {
+		return false
+	}
+	if verifier.backend == BackendBN256 {
+		return verifyBN256(verifier.proof,verifier.challenges,verifier.vk,verifier.E,verifier.F)
+	}
 	res := verify(verifier.proof,verifier.challenges,verifier.vk,verifier.E,verifier.F)
 	return res
-}
\ No newline at end of file
+}
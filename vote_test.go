@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	abcitypes "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	dbm "github.com/tendermint/tm-db"
+	"zkvoting/verifier"
+)
+
+// trapdoorKey is a groth16 key whose secret scalars are known, it proves any
+// public signals without a circuit so the tests can make valid votes
+type trapdoorKey struct {
+	t                         *testing.T
+	curve                     verifier.Bn128
+	alpha, beta, gamma, delta *big.Int
+	ic                        []*big.Int
+}
+
+func newTrapdoorKey(t *testing.T) *trapdoorKey {
+	curve, err := verifier.NewBn128()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &trapdoorKey{t: t, curve: curve}
+	k.alpha, k.beta, k.gamma, k.delta = k.scalar(), k.scalar(), k.scalar(), k.scalar()
+	for i := 0; i <= verifier.NumPublic; i++ {
+		k.ic = append(k.ic, k.scalar())
+	}
+	return k
+}
+
+func (k *trapdoorKey) scalar() *big.Int {
+	n, err := rand.Int(rand.Reader, k.curve.R)
+	if err != nil {
+		k.t.Fatal(err)
+	}
+	return n
+}
+
+// g1 and g2 are s times the generators, as snarkjs writes points
+func (k *trapdoorKey) g1(s *big.Int) []string {
+	p := k.curve.G1.Affine(k.curve.G1.MulScalar(k.curve.G1.G, s))
+	return []string{p[0].String(), p[1].String(), "1"}
+}
+
+func (k *trapdoorKey) g2(s *big.Int) [][]string {
+	p := k.curve.G2.Affine(k.curve.G2.MulScalar(k.curve.G2.G, s))
+	return [][]string{{p[0][0].String(), p[0][1].String()}, {p[1][0].String(), p[1][1].String()}, {"1", "0"}}
+}
+
+// vkey is the verification_key.json of the key
+func (k *trapdoorKey) vkey() []byte {
+	vk := verifier.Groth16VkString{
+		Protocol: verifier.ProtocolGroth16,
+		Curve:    "bn128",
+		NPublic:  verifier.NumPublic,
+		Alpha1:   k.g1(k.alpha),
+		Beta2:    k.g2(k.beta),
+		Gamma2:   k.g2(k.gamma),
+		Delta2:   k.g2(k.delta),
+	}
+	for _, s := range k.ic {
+		vk.IC = append(vk.IC, k.g1(s))
+	}
+	bz, err := json.Marshal(vk)
+	if err != nil {
+		k.t.Fatal(err)
+	}
+	return bz
+}
+
+// prove returns a proof.json for public, A and B are random and C solves
+// a*b = alpha*beta + vk_x*gamma + c*delta
+func (k *trapdoorKey) prove(public []*big.Int) []byte {
+	fr := verifier.NewFq(k.curve.R)
+	x := k.ic[0]
+	for i, s := range public {
+		x = fr.Add(x, fr.Mul(s, k.ic[i+1]))
+	}
+	a, b := k.scalar(), k.scalar()
+	c := fr.Sub(fr.Sub(fr.Mul(a, b), fr.Mul(k.alpha, k.beta)), fr.Mul(x, k.gamma))
+	c = fr.Mul(c, fr.Inverse(k.delta))
+	bz, err := json.Marshal(verifier.Groth16ProofString{
+		Protocol: verifier.ProtocolGroth16,
+		Curve:    "bn128",
+		PiA:      k.g1(a),
+		PiB:      k.g2(b),
+		PiC:      k.g1(c),
+	})
+	if err != nil {
+		k.t.Fatal(err)
+	}
+	return bz
+}
+
+// vote is a vote tx of election with proof for public
+func (k *trapdoorKey) vote(election string, proof []byte, public []*big.Int) []byte {
+	signals := make([]string, len(public))
+	for i, s := range public {
+		signals[i] = s.String()
+	}
+	tx, err := json.Marshal(Trans{Type: "vote", Election: election, Pdata: PData{Proof: proof, Public: signals}})
+	if err != nil {
+		k.t.Fatal(err)
+	}
+	return tx
+}
+
+// TestVoteVerifiedInDeliverTx checks that the code and the event of every
+// vote tell whether it was counted, with duplicates in the same block and
+// bad proofs rejected by DeliverTx itself
+func TestVoteVerifiedInDeliverTx(t *testing.T) {
+	key := newTrapdoorKey(t)
+	chain := newTestChain(t, dbm.NewMemDB(), ed25519.GenPrivKey())
+	data := testElection(t)
+	data.Vkey = key.vkey()
+	chain.block(testBlock{t0, [][]byte{chain.adminTx("e", data)}})
+
+	e := chain.app.elections["e"]
+	public := func(nullifier int64) []*big.Int {
+		return []*big.Int{big.NewInt('A'), big.NewInt(nullifier), e.zktree.GetRoot(), e.signal()}
+	}
+	first := key.vote("e", key.prove(public(1)), public(1))
+	again := key.vote("e", key.prove(public(1)), public(1))
+	forged := key.vote("e", key.prove(public(2)), public(3))
+	second := key.vote("e", key.prove(public(4)), public(4))
+
+	res := chain.block(testBlock{t0 + 60, [][]byte{first, again, forged, second}})
+	want := []uint32{CodeTypeOK, CodeTypeAlreadyVoted, CodeTypeVerificationFailed, CodeTypeOK}
+	for i, r := range res {
+		if r.Code != want[i] {
+			t.Errorf("tx %d: got code %d (%s), want %d", i, r.Code, r.Log, want[i])
+		}
+		if counted := len(r.Events) > 0; counted != (r.Code == CodeTypeOK) {
+			t.Errorf("tx %d: code %d with %d events", i, r.Code, len(r.Events))
+		}
+	}
+	if votes := chain.app.elections["e"].candidate["A"]; votes != 3 {
+		t.Fatalf("candidate A has %d votes, want 1 from the setup and 2 counted", votes)
+	}
+
+	// the committed nullifier keeps rejecting the voter in later blocks and in
+	// the mempool, also when a recheck skips the proof
+	res = chain.block(testBlock{t0 + 61, [][]byte{again}})
+	if res[0].Code != CodeTypeAlreadyVoted {
+		t.Fatalf("next block: got code %d (%s), want %d", res[0].Code, res[0].Log, CodeTypeAlreadyVoted)
+	}
+	for _, typ := range []abcitypes.CheckTxType{abcitypes.CheckTxType_New, abcitypes.CheckTxType_Recheck} {
+		check := chain.app.CheckTx(abcitypes.RequestCheckTx{Tx: again, Type: typ})
+		if check.Code != CodeTypeAlreadyVoted {
+			t.Fatalf("CheckTx %v: got code %d (%s), want %d", typ, check.Code, check.Log, CodeTypeAlreadyVoted)
+		}
+	}
+}
+
+// TestVotesBatchedInBeginBlock checks that the proofs of a block verified in
+// one batch keep their own verdicts, and that DeliverTx reads them
+func TestVotesBatchedInBeginBlock(t *testing.T) {
+	chain := newTestChain(t, dbm.NewMemDB(), ed25519.GenPrivKey())
+	chain.block(testBlock{t0, [][]byte{chain.adminTx("e", testElection(t)), chain.adminTx("f", testElection(t))}})
+
+	// the forged votes fail the batch, the fallback finds them
+	valid := voteTx(t, "e", nil)
+	forged := voteTx(t, "e", []string{"123", "5"})
+	res := chain.block(testBlock{t0 + 60, [][]byte{valid, forged, valid, voteTx(t, "e", []string{"123", "6"})}})
+	want := []uint32{CodeTypeOK, CodeTypeVerificationFailed, CodeTypeAlreadyVoted, CodeTypeVerificationFailed}
+	for i, r := range res {
+		if r.Code != want[i] {
+			t.Errorf("tx %d: got code %d (%s), want %d", i, r.Code, r.Log, want[i])
+		}
+	}
+
+	vote := voteTx(t, "f", nil)
+	app := chain.app
+	app.blockTxs = func(int64) [][]byte { return [][]byte{vote, forged} }
+	app.BeginBlock(abcitypes.RequestBeginBlock{Header: tmproto.Header{Time: time.Unix(t0+61, 0)}})
+	h := sha256.Sum256(vote)
+	v, ok := app.verdicts[h]
+	if !ok || !v.valid || v.key != app.elections["f"].verifyKey {
+		t.Fatalf("verdict of the vote: %+v, %v", v, ok)
+	}
+	if len(app.verdicts) != 2 || app.verdicts[sha256.Sum256(forged)].valid {
+		t.Fatalf("got %d verdicts, want the valid vote and the forged one", len(app.verdicts))
+	}
+
+	// a false verdict turns the vote away, one made with another key is ignored
+	app.verdicts[h] = proofVerdict{key: v.key}
+	r := app.DeliverTx(abcitypes.RequestDeliverTx{Tx: vote})
+	if r.Code != CodeTypeVerificationFailed {
+		t.Fatalf("false verdict: got code %d (%s), want %d", r.Code, r.Log, CodeTypeVerificationFailed)
+	}
+	app.verdicts[h] = proofVerdict{key: app.elections["e"].verifyKey}
+	r = app.DeliverTx(abcitypes.RequestDeliverTx{Tx: vote})
+	if r.Code != CodeTypeOK {
+		t.Fatalf("verdict of another key: got code %d (%s)", r.Code, r.Log)
+	}
+	app.EndBlock(abcitypes.RequestEndBlock{})
+	app.Commit()
+	if app.verdicts != nil {
+		t.Fatal("verdicts kept after Commit")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"zkvoting/verifier"
+)
+
+// proofVerdict is the result of the batch verification of a vote's proof
+// against key, the key of its election when the block began
+type proofVerdict struct {
+	key   verifier.VerifyingKey
+	valid bool
+}
+
+// parseVote reads the proof and the public signals of a vote with the proof
+// system of the election's key
+func (e *Election) parseVote(data PData) (verifier.ZkProof, []*big.Int, error) {
+	public, err := json.Marshal(data.Public)
+	if err != nil {
+		return nil, nil, ErrEncoding.Wrap(err)
+	}
+	proof, err := e.verifyKey.ParseProof(data.Proof)
+	if errors.Is(err, verifier.ErrWrongProtocol) {
+		return nil, nil, ErrWrongProtocol.Wrap(err)
+	}
+	if err != nil {
+		return nil, nil, ErrEncoding.Wrap(err)
+	}
+	pub, err := verifier.ParsePub(public, e.verifyKey.PublicInputs())
+	if err != nil {
+		return nil, nil, ErrEncoding.Wrap(err)
+	}
+	return proof, pub, nil
+}
+
+// verifyBlockVotes verifies the proofs of the votes in txs, one batch per
+// election, and keeps the verdict of every proof by the hash of its tx. A
+// verdict only depends on the tx and the key, so txs that are not in the block
+// after all cost time but never change a result. Votes that can not be counted
+// anyway are left to DeliverTx
+func (app *DApplication) verifyBlockVotes(txs [][]byte) {
+	type batch struct {
+		hashes  [][32]byte
+		proofs  []verifier.ZkProof
+		publics [][]*big.Int
+	}
+	batches := make(map[string]*batch)
+	for _, tx := range txs {
+		var trans Trans
+		if json.Unmarshal(tx, &trans) != nil || trans.Type != "vote" {
+			continue
+		}
+		e, ok := app.elections[trans.Election]
+		if !ok || app.blockTime < e.voteStart || app.blockTime > e.voteEnd {
+			continue
+		}
+		proof, public, err := e.parseVote(trans.Pdata)
+		if err != nil {
+			continue
+		}
+		b := batches[e.id]
+		if b == nil {
+			b = &batch{}
+			batches[e.id] = b
+		}
+		b.hashes = append(b.hashes, sha256.Sum256(tx))
+		b.proofs = append(b.proofs, proof)
+		b.publics = append(b.publics, public)
+	}
+
+	app.verdicts = make(map[[32]byte]proofVerdict)
+	for id, b := range batches {
+		key := app.elections[id].verifyKey
+		valid := verifier.VerifyAll(key, b.proofs, b.publics)
+		for i, h := range b.hashes {
+			app.verdicts[h] = proofVerdict{key: key, valid: valid[i]}
+		}
+	}
+}
+
+// proofValid returns the verdict of BeginBlock for the proof of tx, a proof
+// without one or verified against an earlier key of e is verified on its own
+func (app *DApplication) proofValid(tx []byte, e *Election, proof verifier.ZkProof, public []*big.Int) bool {
+	v, ok := app.verdicts[sha256.Sum256(tx)]
+	if ok && v.key == e.verifyKey {
+		return v.valid
+	}
+	return e.verifyKey.Verify(proof, public)
+}